@@ -113,6 +113,7 @@ func startProxy(logger *zerolog.Logger, proxyConf configProxy.ProxyConf, wg *syn
 		logger.Fatal().Err(err).Msg("failed to convert servers for proxy")
 	}
 	serverService := server.NewService(logger, servers)
+	server.StartHealthChecks(logger, servers)
 
 	rules, err := domain.ConvertRules(routesConf.Rules)
 	if err != nil {
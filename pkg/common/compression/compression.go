@@ -0,0 +1,85 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// Gzip is gzip content encoding
+	Gzip = "gzip"
+	// Deflate is deflate (zlib) content encoding
+	Deflate = "deflate"
+)
+
+// IsSupported returns true when body with given Content-Encoding can be decoded and encoded back
+func IsSupported(encoding string) bool {
+	switch normalize(encoding) {
+	case Gzip, Deflate:
+		return true
+	}
+	return false
+}
+
+// Decode decodes body compressed with given Content-Encoding. Deflate bodies are accepted both with zlib wrapper (as
+// specified) and as raw deflate stream (as sent by some servers)
+func Decode(encoding string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	var err error
+	switch normalize(encoding) {
+	case Gzip:
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case Deflate:
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return nil, errors.Errorf("unsupported content encoding '%v'", encoding)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode '%v' body", encoding)
+	}
+
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode '%v' body", encoding)
+	}
+	return result, nil
+}
+
+// Encode compresses body with given Content-Encoding
+func Encode(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch normalize(encoding) {
+	case Gzip:
+		writer = gzip.NewWriter(&buf)
+	case Deflate:
+		writer = zlib.NewWriter(&buf)
+	default:
+		return nil, errors.Errorf("unsupported content encoding '%v'", encoding)
+	}
+
+	if _, err := writer.Write(body); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode '%v' body", encoding)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode '%v' body", encoding)
+	}
+	return buf.Bytes(), nil
+}
+
+func normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "x-gzip" {
+		return Gzip
+	}
+	return encoding
+}
@@ -0,0 +1,48 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	body := []byte(`<r><nimi>Mari</nimi></r>`)
+
+	for _, encoding := range []string{"gzip", "x-gzip", "deflate", "GZIP"} {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := Encode(encoding, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NotEqual(t, body, encoded)
+
+			decoded, err := Decode(encoding, encoded)
+
+			assert.NoError(t, err)
+			assert.Equal(t, body, decoded)
+		})
+	}
+}
+
+func TestDecodeRawDeflate(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	_, _ = writer.Write([]byte("<r/>"))
+	_ = writer.Close()
+
+	decoded, err := Decode("deflate", buf.Bytes())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("<r/>"), decoded)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	_, err := Decode("gzip", []byte("<r/>"))
+	assert.EqualError(t, err, "failed to decode 'gzip' body: unexpected EOF")
+
+	_, err = Decode("br", []byte("<r/>"))
+	assert.EqualError(t, err, "unsupported content encoding 'br'")
+	assert.False(t, IsSupported("br"))
+}
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
 	"github.com/pkg/errors"
 	"regexp"
 )
@@ -32,3 +33,25 @@ func SliceToRegexp(regexps []string) ([]*regexp.Regexp, error) {
 	}
 	return result, nil
 }
+
+// XPathToSlice converts slice of XPath expressions to slice of strings
+func XPathToSlice(expressions xmldoc.Expressions) []string {
+	result := make([]string, len(expressions))
+	for i, expr := range expressions {
+		result[i] = expr.String()
+	}
+	return result
+}
+
+// SliceToXPath converts slice of strings to slice of XPath expressions compiled with given namespace bindings
+func SliceToXPath(expressions []string, namespaces xmldoc.Namespaces) (xmldoc.Expressions, error) {
+	result := make(xmldoc.Expressions, len(expressions))
+	for i, expr := range expressions {
+		e, err := xmldoc.CompileWithNamespaces(expr, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = e
+	}
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package dto
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
+)
+
+// HeaderMatcherDTO is DTO for X-road SOAP header matcher
+type HeaderMatcherDTO struct {
+	Client           ClientIdentifierDTO `json:"client"`
+	UserID           string              `json:"user_id"`
+	RepresentedParty RepresentedPartyDTO `json:"represented_party"`
+	Issue            string              `json:"issue"`
+	ProtocolVersion  string              `json:"protocol_version"`
+}
+
+// ClientIdentifierDTO is DTO for X-road client identifier
+type ClientIdentifierDTO struct {
+	XRoadInstance string `json:"instance"`
+	MemberClass   string `json:"member_class"`
+	MemberCode    string `json:"member_code"`
+	SubsystemCode string `json:"subsystem_code"`
+}
+
+// RepresentedPartyDTO is DTO for X-road represented party
+type RepresentedPartyDTO struct {
+	PartyClass string `json:"party_class"`
+	PartyCode  string `json:"party_code"`
+}
+
+// HeaderMatcherToDTO converts header matcher to DTO. Empty matcher is converted to nil
+func HeaderMatcherToDTO(m soap.HeaderMatcher) *HeaderMatcherDTO {
+	if m.IsEmpty() {
+		return nil
+	}
+	return &HeaderMatcherDTO{
+		Client: ClientIdentifierDTO{
+			XRoadInstance: m.Client.XRoadInstance,
+			MemberClass:   m.Client.MemberClass,
+			MemberCode:    m.Client.MemberCode,
+			SubsystemCode: m.Client.SubsystemCode,
+		},
+		UserID: m.UserID,
+		RepresentedParty: RepresentedPartyDTO{
+			PartyClass: m.RepresentedParty.PartyClass,
+			PartyCode:  m.RepresentedParty.PartyCode,
+		},
+		Issue:           m.Issue,
+		ProtocolVersion: m.ProtocolVersion,
+	}
+}
+
+// ToHeaderMatcher converts DTO to header matcher. Nil DTO is converted to empty matcher
+func ToHeaderMatcher(m *HeaderMatcherDTO) soap.HeaderMatcher {
+	if m == nil {
+		return soap.HeaderMatcher{}
+	}
+	return soap.HeaderMatcher{
+		Client: soap.ClientIdentifier{
+			XRoadInstance: m.Client.XRoadInstance,
+			MemberClass:   m.Client.MemberClass,
+			MemberCode:    m.Client.MemberCode,
+			SubsystemCode: m.Client.SubsystemCode,
+		},
+		UserID: m.UserID,
+		RepresentedParty: soap.RepresentedParty{
+			PartyClass: m.RepresentedParty.PartyClass,
+			PartyCode:  m.RepresentedParty.PartyCode,
+		},
+		Issue:           m.Issue,
+		ProtocolVersion: m.ProtocolVersion,
+	}
+}
+
+// MatcherDTO is DTO for composable matcher expression
+type MatcherDTO struct {
+	All        []MatcherDTO      `json:"all,omitempty"`
+	Any        []MatcherDTO      `json:"any,omitempty"`
+	Not        *MatcherDTO       `json:"not,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Header     *HeaderMatcherDTO `json:"header,omitempty"`
+	Regex      string            `json:"regex,omitempty"`
+	XPath      string            `json:"xpath,omitempty"`
+	RemoteAddr []string          `json:"remote_addr,omitempty"`
+}
+
+// MatcherToDTO converts matcher expression to DTO. Empty expression is converted to nil
+func MatcherToDTO(e matcher.Expression) *MatcherDTO {
+	if e.IsEmpty() {
+		return nil
+	}
+	result := &MatcherDTO{
+		All:     matchersToDTO(e.All),
+		Any:     matchersToDTO(e.Any),
+		Service: e.Service.String(),
+		Header:  HeaderMatcherToDTO(e.Header),
+	}
+	if e.Not != nil {
+		result.Not = MatcherToDTO(*e.Not)
+		if result.Not == nil {
+			result.Not = &MatcherDTO{}
+		}
+	}
+	if e.Regex != nil {
+		result.Regex = e.Regex.String()
+	}
+	if e.XPath != nil {
+		result.XPath = e.XPath.String()
+	}
+	if len(e.RemoteAddr) != 0 {
+		result.RemoteAddr = e.RemoteAddr.Strings()
+	}
+	return result
+}
+
+func matchersToDTO(expressions []matcher.Expression) []MatcherDTO {
+	if len(expressions) == 0 {
+		return nil
+	}
+	result := make([]MatcherDTO, len(expressions))
+	for i, e := range expressions {
+		if m := MatcherToDTO(e); m != nil {
+			result[i] = *m
+		}
+	}
+	return result
+}
+
+// ToMatcher converts DTO to matcher expression with XPath conditions compiled with given namespace bindings. Nil DTO
+// is converted to empty expression
+func ToMatcher(m *MatcherDTO, namespaces xmldoc.Namespaces) (matcher.Expression, error) {
+	if m == nil {
+		return matcher.Expression{}, nil
+	}
+
+	all, err := toMatchers(m.All, namespaces)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	any, err := toMatchers(m.Any, namespaces)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	var not *matcher.Expression
+	if m.Not != nil {
+		tmp, err := ToMatcher(m.Not, namespaces)
+		if err != nil {
+			return matcher.Expression{}, err
+		}
+		not = &tmp
+	}
+
+	service, err := soap.ParseServiceIdentifier(m.Service)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	regex, err := matcher.CompileRegex(m.Regex)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	xpath, err := matcher.CompileXPath(m.XPath, namespaces)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	remoteAddr, err := remoteaddr.Parse(m.RemoteAddr)
+	if err != nil {
+		return matcher.Expression{}, err
+	}
+
+	return matcher.Expression{
+		All:        all,
+		Any:        any,
+		Not:        not,
+		Service:    service,
+		Header:     ToHeaderMatcher(m.Header),
+		Regex:      regex,
+		XPath:      xpath,
+		RemoteAddr: remoteAddr,
+	}, nil
+}
+
+func toMatchers(dtos []MatcherDTO, namespaces xmldoc.Namespaces) ([]matcher.Expression, error) {
+	if len(dtos) == 0 {
+		return nil, nil
+	}
+	result := make([]matcher.Expression, len(dtos))
+	for i := range dtos {
+		e, err := ToMatcher(&dtos[i], namespaces)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = e
+	}
+	return result, nil
+}
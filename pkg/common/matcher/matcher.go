@@ -0,0 +1,228 @@
+package matcher
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"github.com/pkg/errors"
+	"net"
+	"regexp"
+)
+
+// ScenarioHeader is HTTP header that selects test scenario. Requests with scenario are matched against rules of
+// that scenario first and rules without scenario (shared default) after that
+const ScenarioHeader = "X-Mock-Scenario"
+
+// Request contains request data that matcher expressions are evaluated against
+type Request struct {
+	Header   soap.Header
+	Body     []byte
+	Document *xmldoc.Document
+	ClientIP net.IP
+	// IgnoreServiceCase makes service conditions compare service identifier parts case-insensitively
+	IgnoreServiceCase bool
+}
+
+// NewRequest creates request for matching. Body is parsed as XML document only when XPath condition is evaluated
+func NewRequest(header soap.Header, body []byte, clientIP net.IP) Request {
+	return Request{
+		Header:   header,
+		Body:     body,
+		Document: xmldoc.NewDocument(body),
+		ClientIP: clientIP,
+	}
+}
+
+// Expression is node of matcher tree. Expression matches when all of its set conditions match:
+// every expression in `All`, at least one expression in `Any`, `Not` expression does not match and
+// all leaf conditions (service, header, regex, XPath, remote address) match. Empty expression matches everything
+type Expression struct {
+	All []Expression
+	Any []Expression
+	Not *Expression
+
+	Service    soap.ServiceIdentifier
+	Header     soap.HeaderMatcher
+	Regex      *regexp.Regexp
+	XPath      *xmldoc.Expression
+	RemoteAddr remoteaddr.Matcher
+}
+
+// IsEmpty returns true when expression has no conditions and therefore matches every request
+func (e Expression) IsEmpty() bool {
+	return len(e.All) == 0 &&
+		len(e.Any) == 0 &&
+		e.Not == nil &&
+		e.Service.IsEmpty() &&
+		e.Header.IsEmpty() &&
+		e.Regex == nil &&
+		e.XPath == nil &&
+		len(e.RemoteAddr) == 0
+}
+
+// Match evaluates expression tree against request
+func (e Expression) Match(r Request) bool {
+	if !e.Service.IsEmpty() && !e.matchService(r) {
+		return false
+	}
+	if !e.Header.IsEmpty() && !e.Header.Match(r.Header) {
+		return false
+	}
+	if len(e.RemoteAddr) != 0 && !e.RemoteAddr.Contains(r.ClientIP) {
+		return false
+	}
+	if e.Regex != nil && !e.Regex.Match(r.Body) {
+		return false
+	}
+	if e.XPath != nil && (r.Document == nil || !e.XPath.Match(r.Document)) {
+		return false
+	}
+
+	for _, expr := range e.All {
+		if !expr.Match(r) {
+			return false
+		}
+	}
+	if len(e.Any) != 0 && !e.matchAny(r) {
+		return false
+	}
+	if e.Not != nil && e.Not.Match(r) {
+		return false
+	}
+	return true
+}
+
+func (e Expression) matchService(r Request) bool {
+	if r.IgnoreServiceCase {
+		return e.Service.MatchFold(r.Header.Service)
+	}
+	return e.Service.Match(r.Header.Service)
+}
+
+func (e Expression) matchAny(r Request) bool {
+	for _, expr := range e.Any {
+		if expr.Match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromConf converts matcher configuration to expression tree. XPath conditions are compiled with given namespace
+// bindings
+func FromConf(conf common.MatcherConf, namespaces xmldoc.Namespaces) (Expression, error) {
+	all, err := fromConfs(conf.All, namespaces)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	any, err := fromConfs(conf.Any, namespaces)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	var not *Expression
+	if conf.Not != nil {
+		tmp, err := FromConf(*conf.Not, namespaces)
+		if err != nil {
+			return Expression{}, err
+		}
+		not = &tmp
+	}
+
+	service, err := soap.ParseServiceIdentifier(conf.Service)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	regex, err := CompileRegex(conf.Regex)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	xpath, err := CompileXPath(conf.XPath, namespaces)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	remoteAddr, err := remoteaddr.Parse(conf.RemoteAddr)
+	if err != nil {
+		return Expression{}, err
+	}
+
+	return Expression{
+		All:        all,
+		Any:        any,
+		Not:        not,
+		Service:    service,
+		Header:     HeaderFromConf(conf.Header),
+		Regex:      regex,
+		XPath:      xpath,
+		RemoteAddr: remoteAddr,
+	}, nil
+}
+
+func fromConfs(confs []common.MatcherConf, namespaces xmldoc.Namespaces) ([]Expression, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+	result := make([]Expression, len(confs))
+	for i, c := range confs {
+		expr, err := FromConf(c, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = expr
+	}
+	return result, nil
+}
+
+// HeaderFromConf converts X-road header matcher configuration to soap.HeaderMatcher
+func HeaderFromConf(conf common.HeaderMatcherConf) soap.HeaderMatcher {
+	return soap.HeaderMatcher{
+		Client: ClientFromConf(conf.Client),
+		UserID: conf.UserID,
+		RepresentedParty: soap.RepresentedParty{
+			PartyClass: conf.RepresentedParty.PartyClass,
+			PartyCode:  conf.RepresentedParty.PartyCode,
+		},
+		Issue:           conf.Issue,
+		ProtocolVersion: conf.ProtocolVersion,
+	}
+}
+
+// ClientFromConf converts X-road client identifier configuration to soap.ClientIdentifier
+func ClientFromConf(conf common.ClientIdentifierConf) soap.ClientIdentifier {
+	return soap.ClientIdentifier{
+		XRoadInstance: conf.XRoadInstance,
+		MemberClass:   conf.MemberClass,
+		MemberCode:    conf.MemberCode,
+		SubsystemCode: conf.SubsystemCode,
+	}
+}
+
+// CompileRegex compiles regex condition. Empty expression results nil (condition is not set)
+func CompileRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile matcher regexp")
+	}
+	return regex, nil
+}
+
+// CompileXPath compiles XPath condition with given namespace bindings. Empty expression results nil (condition is not
+// set)
+func CompileXPath(expr string, namespaces xmldoc.Namespaces) (*xmldoc.Expression, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	xpath, err := xmldoc.CompileWithNamespaces(expr, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return &xpath, nil
+}
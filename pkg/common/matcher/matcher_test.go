@@ -0,0 +1,113 @@
+package matcher
+
+import (
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+const testBody = `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+    <SOAP-ENV:Body>
+        <prod:RR456 xmlns:prod="http://rr.x-road.eu/producer/rr">
+            <request><Isikukood>%v</Isikukood></request>
+        </prod:RR456>
+    </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+func TestExpressionMatch(t *testing.T) {
+	// service X for client Y except identities starting with 4
+	expr, err := FromConf(common.MatcherConf{
+		All: []common.MatcherConf{
+			{Service: "rr.RR456.v1"},
+			{Header: common.HeaderMatcherConf{Client: common.ClientIdentifierConf{MemberCode: "70009999"}}},
+		},
+		Not: &common.MatcherConf{
+			XPath: "//*[local-name()='Isikukood'][starts-with(., '4')]",
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name       string
+		service    string
+		memberCode string
+		identity   string
+		expected   bool
+	}{
+		{
+			name:       "ok, all conditions match",
+			service:    "RR456",
+			memberCode: "70009999",
+			identity:   "38211020380",
+			expected:   true,
+		},
+		{
+			name:       "nok, negated condition matches",
+			service:    "RR456",
+			memberCode: "70009999",
+			identity:   "48211020380",
+			expected:   false,
+		},
+		{
+			name:       "nok, different client",
+			service:    "RR456",
+			memberCode: "70001111",
+			identity:   "38211020380",
+			expected:   false,
+		},
+		{
+			name:       "nok, different service",
+			service:    "RR67_muutus",
+			memberCode: "70009999",
+			identity:   "38211020380",
+			expected:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := soap.Header{
+				Client:  soap.ClientIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: tc.memberCode},
+				Service: soap.ServiceIdentifier{SubsystemCode: "rr", ServiceCode: tc.service, ServiceVersion: "v1"},
+			}
+			body := []byte(fmt.Sprintf(testBody, tc.identity))
+
+			assert.Equal(t, tc.expected, expr.Match(NewRequest(header, body, nil)))
+		})
+	}
+}
+
+func TestExpressionMatchAny(t *testing.T) {
+	expr, err := FromConf(common.MatcherConf{
+		Any: []common.MatcherConf{
+			{RemoteAddr: []string{"10.0.0.0/8"}},
+			{Regex: `<Isikukood>382\d+</Isikukood>`},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(fmt.Sprintf(testBody, "38211020380"))
+	assert.True(t, expr.Match(NewRequest(soap.Header{}, body, net.ParseIP("192.168.0.1"))))
+	assert.True(t, expr.Match(NewRequest(soap.Header{}, []byte("<a/>"), net.ParseIP("10.1.1.1"))))
+	assert.False(t, expr.Match(NewRequest(soap.Header{}, []byte("<a/>"), net.ParseIP("192.168.0.1"))))
+}
+
+func TestExpressionIsEmpty(t *testing.T) {
+	expr, err := FromConf(common.MatcherConf{}, nil)
+
+	assert.NoError(t, err)
+	assert.True(t, expr.IsEmpty())
+	assert.True(t, expr.Match(NewRequest(soap.Header{}, nil, nil)))
+}
+
+func TestFromConfInvalid(t *testing.T) {
+	_, err := FromConf(common.MatcherConf{Any: []common.MatcherConf{{Regex: "("}}}, nil)
+	assert.EqualError(t, err, "failed to compile matcher regexp: error parsing regexp: missing closing ): `(`")
+}
@@ -0,0 +1,141 @@
+package remoteaddr
+
+import (
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	headerXForwardedFor = "X-Forwarded-For"
+	headerForwarded     = "Forwarded"
+)
+
+// Matcher is list of networks that IP addresses are matched against
+type Matcher []*net.IPNet
+
+// Parse parses list of IP addresses and CIDR ranges (IPv4 and IPv6) to matcher. Single IP address is converted to
+// network containing only that address
+func Parse(addresses []string) (Matcher, error) {
+	result := make(Matcher, 0, len(addresses))
+	for _, address := range addresses {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		if strings.Contains(address, "/") {
+			_, network, err := net.ParseCIDR(address)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse CIDR range '%v'", address)
+			}
+			result = append(result, network)
+			continue
+		}
+
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("invalid IP address '%v'", address)
+		}
+		result = append(result, singleAddressNetwork(ip))
+	}
+	return result, nil
+}
+
+func singleAddressNetwork(ip net.IP) *net.IPNet {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return &net.IPNet{IP: ipv4, Mask: net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)}
+}
+
+// Contains returns true when IP belongs to any of matcher networks
+func (m Matcher) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range m {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strings converts matcher networks to slice of strings. Single address networks are converted to plain IP address
+func (m Matcher) Strings() []string {
+	result := make([]string, len(m))
+	for i, network := range m {
+		ones, bits := network.Mask.Size()
+		if ones == bits {
+			result[i] = network.IP.String()
+			continue
+		}
+		result[i] = network.String()
+	}
+	return result
+}
+
+// ClientIP resolves IP address of client that sent the request. When request is received from trusted proxy
+// then client address is taken from `Forwarded` or `X-Forwarded-For` header. Addresses in these headers are read
+// from right to left and first address not belonging to trusted proxies is considered as client address.
+func ClientIP(req *http.Request, trustedProxies Matcher) net.IP {
+	ip := parseIP(req.RemoteAddr)
+	if ip == nil || !trustedProxies.Contains(ip) {
+		return ip
+	}
+
+	forwarded := forwardedFor(req.Header)
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIP := parseIP(forwarded[i])
+		if forwardedIP == nil {
+			// obfuscated or unknown identifiers (RFC7239 section 6) can not be trusted any further
+			break
+		}
+		ip = forwardedIP
+		if !trustedProxies.Contains(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// forwardedFor returns list of addresses from `Forwarded` header `for` parameters or when it is missing
+// from `X-Forwarded-For` header
+func forwardedFor(header http.Header) []string {
+	result := make([]string, 0)
+	if values, ok := header[headerForwarded]; ok {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+					if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+						result = append(result, strings.Trim(kv[1], `"`))
+					}
+				}
+			}
+		}
+		return result
+	}
+
+	for _, value := range header[headerXForwardedFor] {
+		for _, address := range strings.Split(value, ",") {
+			result = append(result, strings.TrimSpace(address))
+		}
+	}
+	return result
+}
+
+// parseIP parses IP address from address that could contain port (`127.0.0.1:8080`, `[::1]:8080`)
+func parseIP(address string) net.IP {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		// IPv6 address in brackets without port
+		host = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	}
+	return net.ParseIP(host)
+}
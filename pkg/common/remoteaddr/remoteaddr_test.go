@@ -0,0 +1,91 @@
+package remoteaddr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	matcher, err := Parse([]string{"127.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"}, matcher.Strings())
+
+	_, err = Parse([]string{"127.0.0"})
+	assert.EqualError(t, err, "invalid IP address '127.0.0'")
+}
+
+func TestMatcherContains(t *testing.T) {
+	matcher, err := Parse([]string{"127.0.0.1", "10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, matcher.Contains(net.ParseIP("127.0.0.1")))
+	assert.False(t, matcher.Contains(net.ParseIP("127.0.0.10")))
+	assert.True(t, matcher.Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, matcher.Contains(net.ParseIP("fd12::1")))
+	assert.False(t, matcher.Contains(net.ParseIP("::1")))
+	assert.False(t, matcher.Contains(nil))
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := Parse([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		expected   string
+	}{
+		{
+			name:       "remote address without port",
+			remoteAddr: "192.168.1.10",
+			expected:   "192.168.1.10",
+		},
+		{
+			name:       "untrusted remote address ignores forwarded headers",
+			remoteAddr: "192.168.1.10:5000",
+			header:     http.Header{"X-Forwarded-For": []string{"192.168.1.20"}},
+			expected:   "192.168.1.10",
+		},
+		{
+			name:       "trusted remote address uses X-Forwarded-For",
+			remoteAddr: "10.0.0.1:5000",
+			header:     http.Header{"X-Forwarded-For": []string{"1.1.1.1, 192.168.1.20, 10.0.0.2"}},
+			expected:   "192.168.1.20",
+		},
+		{
+			name:       "trusted remote address uses Forwarded over X-Forwarded-For",
+			remoteAddr: "[::ffff:10.0.0.1]:5000",
+			header: http.Header{
+				"Forwarded":       []string{`for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.3`},
+				"X-Forwarded-For": []string{"192.168.1.20"},
+			},
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:       "only trusted addresses returns leftmost",
+			remoteAddr: "10.0.0.1:5000",
+			header:     http.Header{"X-Forwarded-For": []string{"10.0.0.5, 10.0.0.2"}},
+			expected:   "10.0.0.5",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+
+			assert.Equal(t, tc.expected, ClientIP(req, trusted).String())
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package schedule
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var dayGroups = map[string][]time.Weekday{
+	"daily":    {time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Schedule describes when something (rule) is active. Zero From/Until mean unbounded and empty Windows means
+// always active within From/Until bounds
+type Schedule struct {
+	From    time.Time
+	Until   time.Time
+	Windows []Window
+}
+
+// Window is recurring time window on certain days of week. Window ending before its start continues over midnight
+type Window struct {
+	spec  string
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+// New creates schedule from time bounds and recurring window specifications
+func New(from time.Time, until time.Time, windows []string) (Schedule, error) {
+	if !from.IsZero() && !until.IsZero() && !from.Before(until) {
+		return Schedule{}, errors.New("active_from must be before active_until")
+	}
+
+	result := Schedule{
+		From:  from,
+		Until: until,
+	}
+	for _, spec := range windows {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			return Schedule{}, err
+		}
+		result.Windows = append(result.Windows, w)
+	}
+	return result, nil
+}
+
+// Parse creates schedule from RFC3339 time bounds and recurring window specifications. Empty bounds are unbounded
+func Parse(from string, until string, windows []string) (Schedule, error) {
+	fromTime, err := ParseTime(from)
+	if err != nil {
+		return Schedule{}, err
+	}
+	untilTime, err := ParseTime(until)
+	if err != nil {
+		return Schedule{}, err
+	}
+	return New(fromTime, untilTime, windows)
+}
+
+// FormatTime formats time as RFC3339 timestamp. Zero time results empty string
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ParseTime parses RFC3339 timestamp. Empty string results zero time
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to parse timestamp '%v'", value)
+	}
+	return t, nil
+}
+
+// ParseWindow parses recurring window from its specification '[days] HH:MM-HH:MM' where days are 'daily' (default),
+// 'weekdays', 'weekends', list of days 'mon,wed,fri' or range of days 'mon-fri'. For example 'weekdays 09:00-11:00'
+func ParseWindow(spec string) (Window, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 || len(fields) > 2 {
+		return Window{}, errors.Errorf("invalid schedule window '%v', expected '[days] HH:MM-HH:MM'", spec)
+	}
+
+	daysSpec := "daily"
+	if len(fields) == 2 {
+		daysSpec = fields[0]
+	}
+	days, err := parseDays(daysSpec)
+	if err != nil {
+		return Window{}, errors.Wrapf(err, "invalid schedule window '%v'", spec)
+	}
+
+	timeRange := strings.Split(fields[len(fields)-1], "-")
+	if len(timeRange) != 2 {
+		return Window{}, errors.Errorf("invalid schedule window '%v', expected '[days] HH:MM-HH:MM'", spec)
+	}
+	start, err := parseClock(timeRange[0])
+	if err != nil {
+		return Window{}, errors.Wrapf(err, "invalid schedule window '%v'", spec)
+	}
+	end, err := parseClock(timeRange[1])
+	if err != nil {
+		return Window{}, errors.Wrapf(err, "invalid schedule window '%v'", spec)
+	}
+	if start == end {
+		return Window{}, errors.Errorf("invalid schedule window '%v', empty time range (use 00:00-24:00 for whole day)", spec)
+	}
+
+	return Window{
+		spec:  spec,
+		days:  days,
+		start: start,
+		end:   end,
+	}, nil
+}
+
+func parseDays(spec string) ([7]bool, error) {
+	var result [7]bool
+	if group, ok := dayGroups[spec]; ok {
+		for _, d := range group {
+			result[d] = true
+		}
+		return result, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return result, errors.Errorf("invalid day range '%v'", part)
+		}
+		first, ok := dayNames[bounds[0]]
+		if !ok {
+			return result, errors.Errorf("unknown day '%v'", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, ok = dayNames[bounds[1]]
+			if !ok {
+				return result, errors.Errorf("unknown day '%v'", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			result[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid time '%v', expected 'HH:MM'", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, errors.Errorf("invalid time '%v', expected 'HH:MM'", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, errors.Errorf("invalid time '%v', expected 'HH:MM'", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// IsEmpty returns true when schedule has no restrictions and is therefore always active
+func (s Schedule) IsEmpty() bool {
+	return s.From.IsZero() && s.Until.IsZero() && len(s.Windows) == 0
+}
+
+// IsActive returns true when given time is within schedule bounds and any of its windows
+func (s Schedule) IsActive(now time.Time) bool {
+	if !s.From.IsZero() && now.Before(s.From) {
+		return false
+	}
+	if !s.Until.IsZero() && !now.Before(s.Until) {
+		return false
+	}
+	if len(s.Windows) == 0 {
+		return true
+	}
+	for _, w := range s.Windows {
+		if w.IsActive(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// WindowSpecs returns specifications of schedule windows
+func (s Schedule) WindowSpecs() []string {
+	result := make([]string, len(s.Windows))
+	for i, w := range s.Windows {
+		result[i] = w.String()
+	}
+	return result
+}
+
+// String returns window specification
+func (w Window) String() string {
+	return w.spec
+}
+
+// IsActive returns true when given time (in its own location) is within window
+func (w Window) IsActive(now time.Time) bool {
+	// wall clock time of day and not time elapsed since midnight, which differs on days of DST change
+	sinceMidnight := time.Duration(now.Hour())*time.Hour +
+		time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second +
+		time.Duration(now.Nanosecond())
+	weekday := now.Weekday()
+
+	if w.start <= w.end {
+		return w.days[weekday] && sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+	// window continues over midnight and belongs to the day it starts
+	if w.days[weekday] && sinceMidnight >= w.start {
+		return true
+	}
+	previousDay := (weekday + 6) % 7
+	return w.days[previousDay] && sinceMidnight < w.end
+}
@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		spec          string
+		expectedError string
+	}{
+		{name: "ok, daily by default", spec: "09:00-11:00"},
+		{name: "ok, weekdays", spec: "weekdays 09:00-11:00"},
+		{name: "ok, day list", spec: "mon,wed,fri 09:00-11:00"},
+		{name: "ok, day range over week end", spec: "fri-mon 22:00-02:00"},
+		{
+			name:          "nok, unknown day",
+			spec:          "someday 09:00-11:00",
+			expectedError: "invalid schedule window 'someday 09:00-11:00': unknown day 'someday'",
+		},
+		{
+			name:          "nok, invalid time",
+			spec:          "weekdays 9-11",
+			expectedError: "invalid schedule window 'weekdays 9-11': invalid time '9', expected 'HH:MM'",
+		},
+		{
+			name:          "nok, empty time range",
+			spec:          "daily 00:00-00:00",
+			expectedError: "invalid schedule window 'daily 00:00-00:00', empty time range (use 00:00-24:00 for whole day)",
+		},
+		{
+			name:          "nok, missing time range",
+			spec:          "weekdays",
+			expectedError: "invalid schedule window 'weekdays', expected '[days] HH:MM-HH:MM'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := ParseWindow(tc.spec)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.spec, w.String())
+		})
+	}
+}
+
+func TestScheduleIsActive(t *testing.T) {
+	from := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s, err := New(from, until, []string{"weekdays 09:00-11:00", "sat 23:00-01:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name     string
+		when     time.Time
+		expected bool
+	}{
+		{name: "monday inside window", when: time.Date(2019, 6, 3, 9, 30, 0, 0, time.UTC), expected: true},
+		{name: "monday window end is exclusive", when: time.Date(2019, 6, 3, 11, 0, 0, 0, time.UTC), expected: false},
+		{name: "sunday morning", when: time.Date(2019, 6, 2, 9, 30, 0, 0, time.UTC), expected: false},
+		{name: "saturday night", when: time.Date(2019, 6, 8, 23, 30, 0, 0, time.UTC), expected: true},
+		{name: "saturday window continues to sunday", when: time.Date(2019, 6, 9, 0, 30, 0, 0, time.UTC), expected: true},
+		{name: "before active_from", when: time.Date(2019, 5, 31, 9, 30, 0, 0, time.UTC), expected: false},
+		{name: "after active_until", when: time.Date(2019, 7, 1, 9, 30, 0, 0, time.UTC), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, s.IsActive(tc.when))
+		})
+	}
+}
+
+func TestWindowIsActiveOnDSTChangeDay(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Tallinn")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+	w, err := ParseWindow("10:00-11:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clocks were moved from 03:00 to 04:00 on 2019-03-31
+	assert.True(t, w.IsActive(time.Date(2019, 3, 31, 10, 30, 0, 0, location)))
+	assert.False(t, w.IsActive(time.Date(2019, 3, 31, 9, 30, 0, 0, location)))
+}
+
+func TestNewInvalidBounds(t *testing.T) {
+	from := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := New(from, from, nil)
+
+	assert.EqualError(t, err, "active_from must be before active_until")
+}
@@ -8,10 +8,44 @@ import (
 
 // Envelope is used to unmarshal service info out of X-road request
 type Envelope struct {
-	SubsystemCode  string `xml:"Header>service>subsystemCode"`
-	ServiceCode    string `xml:"Header>service>serviceCode"`
-	ServiceVersion string `xml:"Header>service>serviceVersion"`
-	Service        string
+	Header Header `xml:"Header"`
+	// Service is short service name (subsystemCode.serviceCode.serviceVersion)
+	Service string `xml:"-"`
+}
+
+// Header is X-road SOAP header of request
+type Header struct {
+	Client           ClientIdentifier  `xml:"client"`
+	Service          ServiceIdentifier `xml:"service"`
+	ID               string            `xml:"id"`
+	UserID           string            `xml:"userId"`
+	Issue            string            `xml:"issue"`
+	ProtocolVersion  string            `xml:"protocolVersion"`
+	RepresentedParty RepresentedParty  `xml:"representedParty"`
+}
+
+// ClientIdentifier identifies X-road client (member or subsystem) that sent request
+type ClientIdentifier struct {
+	XRoadInstance string `xml:"xRoadInstance"`
+	MemberClass   string `xml:"memberClass"`
+	MemberCode    string `xml:"memberCode"`
+	SubsystemCode string `xml:"subsystemCode"`
+}
+
+// ServiceIdentifier identifies X-road service that request is sent to
+type ServiceIdentifier struct {
+	XRoadInstance  string `xml:"xRoadInstance"`
+	MemberClass    string `xml:"memberClass"`
+	MemberCode     string `xml:"memberCode"`
+	SubsystemCode  string `xml:"subsystemCode"`
+	ServiceCode    string `xml:"serviceCode"`
+	ServiceVersion string `xml:"serviceVersion"`
+}
+
+// RepresentedParty identifies party that client is representing in request
+type RepresentedParty struct {
+	PartyClass string `xml:"partyClass"`
+	PartyCode  string `xml:"partyCode"`
 }
 
 // FromRequestBody unmarshals request body bytes to envelope
@@ -23,7 +57,26 @@ func FromRequestBody(requestBody []byte) (Envelope, error) {
 		return Envelope{}, errors.Wrap(err, "failed to unmarshal SOAP envelope data")
 	}
 
-	s.Service = fmt.Sprintf("%v.%v.%v", s.SubsystemCode, s.ServiceCode, s.ServiceVersion)
+	s.Service = s.Header.ServiceName()
 
 	return s, nil
 }
+
+// ServiceName returns service of header in short form (subsystemCode.serviceCode.serviceVersion)
+func (h Header) ServiceName() string {
+	return fmt.Sprintf("%v.%v.%v", h.Service.SubsystemCode, h.Service.ServiceCode, h.Service.ServiceVersion)
+}
+
+// IsEmpty returns true when client identifier has no parts set (request without client in header)
+func (c ClientIdentifier) IsEmpty() bool {
+	return c == ClientIdentifier{}
+}
+
+// String returns client identifier in X-road format (instance/memberClass/memberCode/subsystemCode)
+func (c ClientIdentifier) String() string {
+	result := fmt.Sprintf("%v/%v/%v", c.XRoadInstance, c.MemberClass, c.MemberCode)
+	if c.SubsystemCode != "" {
+		result += "/" + c.SubsystemCode
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package soap
+
+import (
+	test_test "github.com/aldas/xroad-mock-proxy/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromRequestBody(t *testing.T) {
+	envelope, err := FromRequestBody(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "rr.RR456.v1", envelope.Service)
+	assert.Equal(t, ClientIdentifier{
+		XRoadInstance: "ee-test",
+		MemberClass:   "GOV",
+		MemberCode:    "70009999",
+		SubsystemCode: "mocksystem",
+	}, envelope.Header.Client)
+	assert.Equal(t, "EE11111111111", envelope.Header.UserID)
+	assert.Equal(t, "nkvw9k2AVvrukYlVAGXRYg", envelope.Header.ID)
+	assert.Equal(t, "4.0", envelope.Header.ProtocolVersion)
+}
+
+func TestHeaderMatcherMatch(t *testing.T) {
+	header := Header{
+		Client: ClientIdentifier{
+			XRoadInstance: "ee-test",
+			MemberClass:   "GOV",
+			MemberCode:    "70009999",
+			SubsystemCode: "mocksystem",
+		},
+		UserID:           "EE11111111111",
+		ProtocolVersion:  "4.0",
+		RepresentedParty: RepresentedParty{PartyClass: "COM", PartyCode: "12345678"},
+	}
+
+	var testCases = []struct {
+		name     string
+		matcher  HeaderMatcher
+		expected bool
+	}{
+		{
+			name:     "empty matcher matches everything",
+			matcher:  HeaderMatcher{},
+			expected: true,
+		},
+		{
+			name:     "client subsystem matches",
+			matcher:  HeaderMatcher{Client: ClientIdentifier{SubsystemCode: "mocksystem"}},
+			expected: true,
+		},
+		{
+			name:     "client member code does not match",
+			matcher:  HeaderMatcher{Client: ClientIdentifier{MemberCode: "70008899"}},
+			expected: false,
+		},
+		{
+			name:     "userId and represented party match",
+			matcher:  HeaderMatcher{UserID: "EE11111111111", RepresentedParty: RepresentedParty{PartyCode: "12345678"}},
+			expected: true,
+		},
+		{
+			name:     "issue does not match",
+			matcher:  HeaderMatcher{Issue: "issue-1"},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.matcher.Match(header))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+const (
+	// FaultCodeNetworkError is X-road fault code for failing to connect or communicate with server
+	FaultCodeNetworkError = "Server.ClientProxy.NetworkError"
+	// FaultCodeSslAuthenticationFailed is X-road fault code for failed TLS handshake or certificate verification
+	FaultCodeSslAuthenticationFailed = "Server.ClientProxy.SslAuthenticationFailed"
+	// FaultCodeInternalError is X-road fault code for unexpected errors
+	FaultCodeInternalError = "Server.ClientProxy.InternalError"
+)
+
+// faultEnvelope is used to detect SOAP fault in response
+type faultEnvelope struct {
+	Body struct {
+		Fault *struct{} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// NewFault creates SOAP 1.1 fault envelope with given fault code and string. Non empty X-road header (usually from
+// request) is echoed into fault envelope
+func NewFault(header Header, faultCode string, faultString string) []byte {
+	data := struct {
+		Header *Header
+		Code   string
+		String string
+	}{nil, faultCode, faultString}
+	if header != (Header{}) {
+		data.Header = &header
+	}
+
+	var buf bytes.Buffer
+	_ = templates.ExecuteTemplate(&buf, "fault", data)
+	return buf.Bytes()
+}
+
+// IsFault returns true when body is SOAP envelope containing fault
+func IsFault(body []byte) bool {
+	envelope := faultEnvelope{}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return false
+	}
+	return envelope.Body.Fault != nil
+}
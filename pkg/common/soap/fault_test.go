@@ -0,0 +1,39 @@
+package soap
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewFault(t *testing.T) {
+	header := Header{
+		Client:           ClientIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70009999", SubsystemCode: "mocksystem"},
+		Service:          ServiceIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70008899", SubsystemCode: "rr", ServiceCode: "RR456", ServiceVersion: "v1"},
+		ID:               "request-1",
+		UserID:           "EE11111111111",
+		ProtocolVersion:  "4.0",
+		RepresentedParty: RepresentedParty{PartyClass: "COM", PartyCode: "12345678"},
+	}
+
+	fault := NewFault(header, FaultCodeNetworkError, "connection refused & closed")
+
+	assert.True(t, IsFault(fault))
+	assert.Contains(t, string(fault), "<faultcode>Server.ClientProxy.NetworkError</faultcode>")
+	assert.Contains(t, string(fault), "<faultstring>connection refused &amp; closed</faultstring>")
+
+	envelope, err := FromRequestBody(fault)
+	assert.NoError(t, err)
+	assert.Equal(t, header, envelope.Header)
+}
+
+func TestNewFaultWithoutHeader(t *testing.T) {
+	fault := NewFault(Header{}, FaultCodeInternalError, "failure")
+
+	assert.True(t, IsFault(fault))
+	assert.NotContains(t, string(fault), "SOAP-ENV:Header")
+}
+
+func TestIsFault(t *testing.T) {
+	assert.False(t, IsFault([]byte(`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body><response/></SOAP-ENV:Body></SOAP-ENV:Envelope>`)))
+	assert.False(t, IsFault([]byte("not xml")))
+}
@@ -0,0 +1,40 @@
+package soap
+
+// HeaderMatcher describes X-road header field values request must have. Empty fields match any value
+type HeaderMatcher struct {
+	Client           ClientIdentifier
+	UserID           string
+	RepresentedParty RepresentedParty
+	Issue            string
+	ProtocolVersion  string
+}
+
+// IsEmpty returns true when matcher has no fields set and therefore matches every header
+func (m HeaderMatcher) IsEmpty() bool {
+	return m == HeaderMatcher{}
+}
+
+// Match returns true when all set fields of matcher are equal to given header fields
+func (m HeaderMatcher) Match(header Header) bool {
+	return m.Client.match(header.Client) &&
+		m.RepresentedParty.match(header.RepresentedParty) &&
+		matchField(m.UserID, header.UserID) &&
+		matchField(m.Issue, header.Issue) &&
+		matchField(m.ProtocolVersion, header.ProtocolVersion)
+}
+
+func (c ClientIdentifier) match(other ClientIdentifier) bool {
+	return matchField(c.XRoadInstance, other.XRoadInstance) &&
+		matchField(c.MemberClass, other.MemberClass) &&
+		matchField(c.MemberCode, other.MemberCode) &&
+		matchField(c.SubsystemCode, other.SubsystemCode)
+}
+
+func (p RepresentedParty) match(other RepresentedParty) bool {
+	return matchField(p.PartyClass, other.PartyClass) &&
+		matchField(p.PartyCode, other.PartyCode)
+}
+
+func matchField(expected string, actual string) bool {
+	return expected == "" || expected == actual
+}
@@ -0,0 +1,77 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"text/template"
+)
+
+const envelopeNamespaces = `xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xrd="http://x-road.eu/xsd/xroad.xsd" xmlns:id="http://x-road.eu/xsd/identifiers"`
+
+var templates = template.Must(template.New("soap").Funcs(template.FuncMap{"xml": EscapeXML}).Parse(`
+{{- define "header" -}}
+    <SOAP-ENV:Header>
+        <xrd:client id:objectType="{{if .Client.SubsystemCode}}SUBSYSTEM{{else}}MEMBER{{end}}">
+            <id:xRoadInstance>{{xml .Client.XRoadInstance}}</id:xRoadInstance>
+            <id:memberClass>{{xml .Client.MemberClass}}</id:memberClass>
+            <id:memberCode>{{xml .Client.MemberCode}}</id:memberCode>{{if .Client.SubsystemCode}}
+            <id:subsystemCode>{{xml .Client.SubsystemCode}}</id:subsystemCode>{{end}}
+        </xrd:client>
+        <xrd:service id:objectType="SERVICE">
+            <id:xRoadInstance>{{xml .Service.XRoadInstance}}</id:xRoadInstance>
+            <id:memberClass>{{xml .Service.MemberClass}}</id:memberClass>
+            <id:memberCode>{{xml .Service.MemberCode}}</id:memberCode>{{if .Service.SubsystemCode}}
+            <id:subsystemCode>{{xml .Service.SubsystemCode}}</id:subsystemCode>{{end}}
+            <id:serviceCode>{{xml .Service.ServiceCode}}</id:serviceCode>{{if .Service.ServiceVersion}}
+            <id:serviceVersion>{{xml .Service.ServiceVersion}}</id:serviceVersion>{{end}}
+        </xrd:service>{{if .RepresentedParty.PartyCode}}
+        <repr:representedParty xmlns:repr="http://x-road.eu/xsd/representation.xsd">{{if .RepresentedParty.PartyClass}}
+            <repr:partyClass>{{xml .RepresentedParty.PartyClass}}</repr:partyClass>{{end}}
+            <repr:partyCode>{{xml .RepresentedParty.PartyCode}}</repr:partyCode>
+        </repr:representedParty>{{end}}
+        <xrd:id>{{xml .ID}}</xrd:id>{{if .UserID}}
+        <xrd:userId>{{xml .UserID}}</xrd:userId>{{end}}{{if .Issue}}
+        <xrd:issue>{{xml .Issue}}</xrd:issue>{{end}}
+        <xrd:protocolVersion>{{if .ProtocolVersion}}{{xml .ProtocolVersion}}{{else}}4.0{{end}}</xrd:protocolVersion>
+    </SOAP-ENV:Header>
+{{- end -}}
+
+{{- define "metaService" -}}
+<SOAP-ENV:Envelope ` + envelopeNamespaces + `>
+{{template "header" .}}
+    <SOAP-ENV:Body>
+        <xrd:{{xml .Service.ServiceCode}}/>
+    </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>
+{{- end -}}
+
+{{- define "fault" -}}
+<SOAP-ENV:Envelope ` + envelopeNamespaces + `>
+{{- if .Header}}
+{{template "header" .Header}}{{end}}
+    <SOAP-ENV:Body>
+        <SOAP-ENV:Fault>
+            <faultcode>{{xml .Code}}</faultcode>
+            <faultstring>{{xml .String}}</faultstring>
+        </SOAP-ENV:Fault>
+    </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>
+{{- end -}}
+`))
+
+// MetaServiceRequest creates X-road metaservice (for example: listMethods) request body for given client and service
+func MetaServiceRequest(ID string, client ClientIdentifier, service ServiceIdentifier) ([]byte, error) {
+	var buf bytes.Buffer
+	err := templates.ExecuteTemplate(&buf, "metaService", Header{ID: ID, Client: client, Service: service})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EscapeXML escapes value for use as XML text or attribute value
+func EscapeXML(value string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
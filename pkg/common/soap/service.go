@@ -0,0 +1,201 @@
+package soap
+
+import (
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"github.com/pkg/errors"
+	"path"
+	"strings"
+)
+
+const (
+	serviceFullFormPrefix = "SERVICE:"
+	serviceFullFormParts  = 6
+	serviceShortFormParts = 3
+	serviceWildcard       = "*"
+	servicePatternChars   = "*?[\\"
+)
+
+// ParseServiceIdentifier parses service identifier from its string form. Supported forms are full X-road form
+// 'instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion' (optionally prefixed with 'SERVICE:')
+// and short form 'subsystemCode.serviceCode.serviceVersion'. Empty parts of full form are allowed and match any value.
+// Short form parts can not be empty ('rr.RR456.' is an error), use '*' to match any value.
+// Parts can be glob patterns (see path.Match) for example 'rr.RR456.*' or '*.*.v2'. Short form ending with '*'
+// can omit remaining parts ('rr.*' is same as 'rr.*.*').
+func ParseServiceIdentifier(service string) (ServiceIdentifier, error) {
+	service = strings.TrimSpace(service)
+	if service == "" {
+		return ServiceIdentifier{}, nil
+	}
+
+	if strings.HasPrefix(service, serviceFullFormPrefix) || strings.Contains(service, "/") {
+		parts := strings.Split(strings.TrimPrefix(service, serviceFullFormPrefix), "/")
+		if len(parts) != serviceFullFormParts {
+			return ServiceIdentifier{}, errors.Errorf("invalid service identifier '%v', expected 'instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion'", service)
+		}
+		return validated(ServiceIdentifier{
+			XRoadInstance:  parts[0],
+			MemberClass:    parts[1],
+			MemberCode:     parts[2],
+			SubsystemCode:  parts[3],
+			ServiceCode:    parts[4],
+			ServiceVersion: parts[5],
+		})
+	}
+
+	parts := strings.Split(service, ".")
+	if len(parts) < serviceShortFormParts && parts[len(parts)-1] == serviceWildcard {
+		// trailing wildcard covers all omitted parts
+		for len(parts) < serviceShortFormParts {
+			parts = append(parts, serviceWildcard)
+		}
+	}
+	if len(parts) < serviceShortFormParts {
+		return ServiceIdentifier{}, errors.Errorf("invalid service name '%v', expected 'subsystemCode.serviceCode.serviceVersion'", service)
+	}
+	last := len(parts) - 1
+	for _, part := range parts {
+		if part == "" {
+			return ServiceIdentifier{}, errors.Errorf("invalid service name '%v', parts can not be empty, use '*' to match any value", service)
+		}
+	}
+	return validated(ServiceIdentifier{
+		SubsystemCode: parts[0],
+		// service code itself could contain dots
+		ServiceCode:    strings.Join(parts[1:last], "."),
+		ServiceVersion: parts[last],
+	})
+}
+
+// ParseRuleService parses service of rule. Unlike ParseServiceIdentifier it does not allow empty service so that rule
+// without service does not match every service by accident. Rule matching all services must use '*'
+func ParseRuleService(service string) (ServiceIdentifier, error) {
+	if strings.TrimSpace(service) == "" {
+		return ServiceIdentifier{}, errors.New("rule service can not be empty, use '*' to match all services")
+	}
+	return ParseServiceIdentifier(service)
+}
+
+// ConvertRuleService converts rule service given either in string form or as service identifier parts
+func ConvertRuleService(service string, conf common.ServiceIdentifierConf) (ServiceIdentifier, error) {
+	identifier := ServiceIdentifier{
+		XRoadInstance:  conf.XRoadInstance,
+		MemberClass:    conf.MemberClass,
+		MemberCode:     conf.MemberCode,
+		SubsystemCode:  conf.SubsystemCode,
+		ServiceCode:    conf.ServiceCode,
+		ServiceVersion: conf.ServiceVersion,
+	}
+	if identifier.IsEmpty() {
+		return ParseRuleService(service)
+	}
+	if service != "" {
+		return ServiceIdentifier{}, errors.New("service and service_identifier can not be both set")
+	}
+	if err := identifier.Validate(); err != nil {
+		return ServiceIdentifier{}, err
+	}
+	return identifier, nil
+}
+
+func validated(s ServiceIdentifier) (ServiceIdentifier, error) {
+	if err := s.Validate(); err != nil {
+		return ServiceIdentifier{}, err
+	}
+	return s, nil
+}
+
+// Validate checks that all parts of identifier are valid glob patterns
+func (s ServiceIdentifier) Validate() error {
+	for _, part := range s.parts() {
+		if _, err := path.Match(part, ""); err != nil {
+			return errors.Errorf("invalid service pattern '%v'", part)
+		}
+	}
+	return nil
+}
+
+// Specificity returns how specific identifier is. Exact parts weigh more than patterns and empty parts do not
+// count at all, so exact identifier is always more specific than pattern covering the same service
+func (s ServiceIdentifier) Specificity() int {
+	result := 0
+	for _, part := range s.parts() {
+		switch {
+		case part == "":
+		case isPattern(part):
+			result++
+		default:
+			result += 2
+		}
+	}
+	return result
+}
+
+func (s ServiceIdentifier) parts() []string {
+	return []string{
+		s.XRoadInstance,
+		s.MemberClass,
+		s.MemberCode,
+		s.SubsystemCode,
+		s.ServiceCode,
+		s.ServiceVersion,
+	}
+}
+
+// IsEmpty returns true when identifier has no parts set and therefore matches every service
+func (s ServiceIdentifier) IsEmpty() bool {
+	return s == ServiceIdentifier{}
+}
+
+// String returns identifier in short form (subsystemCode.serviceCode.serviceVersion) when only these parts are set
+// and in full X-road form (instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion) otherwise
+func (s ServiceIdentifier) String() string {
+	if s.IsEmpty() {
+		return ""
+	}
+	// short form can not have empty parts
+	if s.XRoadInstance == "" && s.MemberClass == "" && s.MemberCode == "" &&
+		s.SubsystemCode != "" && s.ServiceCode != "" && s.ServiceVersion != "" {
+		return fmt.Sprintf("%v.%v.%v", s.SubsystemCode, s.ServiceCode, s.ServiceVersion)
+	}
+	return strings.Join(s.parts(), "/")
+}
+
+// Match returns true when all set parts of identifier are equal to (or match as pattern) corresponding parts of
+// given service
+func (s ServiceIdentifier) Match(service ServiceIdentifier) bool {
+	return s.match(service, matchPattern)
+}
+
+// MatchFold is same as Match but compares parts case-insensitively
+func (s ServiceIdentifier) MatchFold(service ServiceIdentifier) bool {
+	return s.match(service, matchPatternFold)
+}
+
+func (s ServiceIdentifier) match(service ServiceIdentifier, matchPart func(expected string, actual string) bool) bool {
+	return matchPart(s.XRoadInstance, service.XRoadInstance) &&
+		matchPart(s.MemberClass, service.MemberClass) &&
+		matchPart(s.MemberCode, service.MemberCode) &&
+		matchPart(s.SubsystemCode, service.SubsystemCode) &&
+		matchPart(s.ServiceCode, service.ServiceCode) &&
+		matchPart(s.ServiceVersion, service.ServiceVersion)
+}
+
+func isPattern(part string) bool {
+	return strings.ContainsAny(part, servicePatternChars)
+}
+
+func matchPattern(expected string, actual string) bool {
+	if expected == "" {
+		return true
+	}
+	if !isPattern(expected) {
+		return expected == actual
+	}
+	matched, _ := path.Match(expected, actual)
+	return matched
+}
+
+func matchPatternFold(expected string, actual string) bool {
+	return matchPattern(strings.ToLower(expected), strings.ToLower(actual))
+}
@@ -0,0 +1,177 @@
+package soap
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseServiceIdentifier(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		service       string
+		expected      ServiceIdentifier
+		expectedError string
+	}{
+		{
+			name:     "empty service matches everything",
+			service:  "",
+			expected: ServiceIdentifier{},
+		},
+		{
+			name:     "short form",
+			service:  "rr.RR456.v1",
+			expected: ServiceIdentifier{SubsystemCode: "rr", ServiceCode: "RR456", ServiceVersion: "v1"},
+		},
+		{
+			name:     "short form with dots in service code",
+			service:  "rr.RR.456.v1",
+			expected: ServiceIdentifier{SubsystemCode: "rr", ServiceCode: "RR.456", ServiceVersion: "v1"},
+		},
+		{
+			name:    "full form",
+			service: "ee-test/GOV/70008899/rr/RR456/v1",
+			expected: ServiceIdentifier{
+				XRoadInstance:  "ee-test",
+				MemberClass:    "GOV",
+				MemberCode:     "70008899",
+				SubsystemCode:  "rr",
+				ServiceCode:    "RR456",
+				ServiceVersion: "v1",
+			},
+		},
+		{
+			name:     "full form with prefix and empty parts",
+			service:  "SERVICE:ee-test//70008899/rr/RR456/",
+			expected: ServiceIdentifier{XRoadInstance: "ee-test", MemberCode: "70008899", SubsystemCode: "rr", ServiceCode: "RR456"},
+		},
+		{
+			name:     "short form with trailing wildcard",
+			service:  "rr.*",
+			expected: ServiceIdentifier{SubsystemCode: "rr", ServiceCode: "*", ServiceVersion: "*"},
+		},
+		{
+			name:     "short form with patterns",
+			service:  "*.RR4[0-9]?.v2",
+			expected: ServiceIdentifier{SubsystemCode: "*", ServiceCode: "RR4[0-9]?", ServiceVersion: "v2"},
+		},
+		{
+			name:          "invalid pattern",
+			service:       "rr.RR[456.v1",
+			expectedError: "invalid service pattern 'RR[456'",
+		},
+		{
+			name:          "invalid full form",
+			service:       "ee-test/GOV/rr/RR456/v1",
+			expectedError: "invalid service identifier 'ee-test/GOV/rr/RR456/v1', expected 'instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion'",
+		},
+		{
+			name:          "short form with empty version",
+			service:       "rr.RR456.",
+			expectedError: "invalid service name 'rr.RR456.', parts can not be empty, use '*' to match any value",
+		},
+		{
+			name:          "short form with empty service code",
+			service:       "rr..v1",
+			expectedError: "invalid service name 'rr..v1', parts can not be empty, use '*' to match any value",
+		},
+		{
+			name:     "full form without version",
+			service:  "///rr/RR456/",
+			expected: ServiceIdentifier{SubsystemCode: "rr", ServiceCode: "RR456"},
+		},
+		{
+			name:          "invalid short form",
+			service:       "RR456",
+			expectedError: "invalid service name 'RR456', expected 'subsystemCode.serviceCode.serviceVersion'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ParseServiceIdentifier(tc.service)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+			assert.Equal(t, tc.expected, mustParseServiceIdentifier(t, result.String()))
+		})
+	}
+}
+
+func TestServiceIdentifierMatch(t *testing.T) {
+	service := ServiceIdentifier{
+		XRoadInstance:  "ee-test",
+		MemberClass:    "GOV",
+		MemberCode:     "70008899",
+		SubsystemCode:  "rr",
+		ServiceCode:    "RR456",
+		ServiceVersion: "v1",
+	}
+
+	assert.True(t, mustParseServiceIdentifier(t, "rr.RR456.v1").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "ee-test/GOV/70008899/rr/RR456/v1").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "//70008899/rr//").Match(service))
+	assert.False(t, mustParseServiceIdentifier(t, "ee-test/GOV/70001111/rr/RR456/v1").Match(service))
+	assert.False(t, mustParseServiceIdentifier(t, "rr.rr456.v1").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "rr.rr456.v1").MatchFold(service))
+}
+
+func TestServiceIdentifierMatchPattern(t *testing.T) {
+	service := ServiceIdentifier{
+		XRoadInstance:  "ee-test",
+		MemberClass:    "GOV",
+		MemberCode:     "70008899",
+		SubsystemCode:  "rr",
+		ServiceCode:    "RR456",
+		ServiceVersion: "v2",
+	}
+
+	assert.True(t, mustParseServiceIdentifier(t, "rr.*").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "rr.RR456.*").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "*.*.v2").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "ee-*/GOV/*/rr/RR4??/v*").Match(service))
+	assert.False(t, mustParseServiceIdentifier(t, "*.*.v1").Match(service))
+	assert.False(t, mustParseServiceIdentifier(t, "xtee.*").Match(service))
+	assert.False(t, mustParseServiceIdentifier(t, "RR.rr456.*").Match(service))
+	assert.True(t, mustParseServiceIdentifier(t, "RR.rr456.*").MatchFold(service))
+}
+
+func TestServiceIdentifierSpecificity(t *testing.T) {
+	exact := mustParseServiceIdentifier(t, "rr.RR456.v2").Specificity()
+	version := mustParseServiceIdentifier(t, "rr.RR456.*").Specificity()
+	subsystem := mustParseServiceIdentifier(t, "rr.*").Specificity()
+	any := mustParseServiceIdentifier(t, "*").Specificity()
+
+	assert.True(t, exact > version)
+	assert.True(t, version > subsystem)
+	assert.True(t, subsystem > any)
+	assert.True(t, any > ServiceIdentifier{}.Specificity())
+}
+
+func mustParseServiceIdentifier(t *testing.T, service string) ServiceIdentifier {
+	result, err := ParseServiceIdentifier(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestConvertRuleService(t *testing.T) {
+	_, err := ConvertRuleService("", common.ServiceIdentifierConf{})
+	assert.EqualError(t, err, "rule service can not be empty, use '*' to match all services")
+
+	all, err := ConvertRuleService("*", common.ServiceIdentifierConf{})
+	assert.NoError(t, err)
+	assert.True(t, all.Match(ServiceIdentifier{XRoadInstance: "ee-test", SubsystemCode: "rr", ServiceCode: "RR456", ServiceVersion: "v1"}))
+
+	identifier, err := ConvertRuleService("", common.ServiceIdentifierConf{SubsystemCode: "rr", ServiceCode: "RR456"})
+	assert.NoError(t, err)
+	assert.Equal(t, ServiceIdentifier{SubsystemCode: "rr", ServiceCode: "RR456"}, identifier)
+
+	_, err = ConvertRuleService("rr.RR456.v1", common.ServiceIdentifierConf{SubsystemCode: "rr"})
+	assert.EqualError(t, err, "service and service_identifier can not be both set")
+}
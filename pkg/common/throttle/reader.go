@@ -0,0 +1,64 @@
+package throttle
+
+import (
+	"io"
+	"time"
+)
+
+// chunksPerSecond is how many times per second throttled reader hands out data. Smaller chunks make stream smoother
+const chunksPerSecond = 10
+
+// Reader limits speed data is read from underlying reader to given number of bytes per second
+type Reader struct {
+	reader         io.ReadCloser
+	bytesPerSecond int64
+	chunkSize      int
+
+	start time.Time
+	read  int64
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// NewReader creates reader that reads from given reader at most bytesPerSecond bytes per second. Reader is returned
+// as is when bytesPerSecond is not positive
+func NewReader(reader io.ReadCloser, bytesPerSecond int64) io.ReadCloser {
+	if bytesPerSecond <= 0 || reader == nil {
+		return reader
+	}
+	chunkSize := int(bytesPerSecond / chunksPerSecond)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	return &Reader{
+		reader:         reader,
+		bytesPerSecond: bytesPerSecond,
+		chunkSize:      chunkSize,
+		sleep:          time.Sleep,
+		now:            time.Now,
+	}
+}
+
+// Read reads next chunk from underlying reader and waits until average speed since first read is within limit
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = r.now()
+	}
+	if len(p) > r.chunkSize {
+		p = p[:r.chunkSize]
+	}
+
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	expected := time.Duration(float64(r.read) / float64(r.bytesPerSecond) * float64(time.Second))
+	if wait := expected - r.now().Sub(r.start); wait > 0 {
+		r.sleep(wait)
+	}
+	return n, err
+}
+
+// Close closes underlying reader
+func (r *Reader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,31 @@
+package throttle
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 1000)
+	reader := NewReader(ioutil.NopCloser(bytes.NewReader(data)), 100).(*Reader)
+
+	now := time.Date(2019, 6, 1, 9, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	reader.now = func() time.Time { return now.Add(slept) }
+	reader.sleep = func(d time.Duration) { slept += d }
+
+	result, err := ioutil.ReadAll(reader)
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+	assert.Equal(t, 10*time.Second, slept)
+}
+
+func TestNewReaderWithoutLimit(t *testing.T) {
+	body := ioutil.NopCloser(bytes.NewReader([]byte("a")))
+
+	assert.Equal(t, body, NewReader(body, 0))
+}
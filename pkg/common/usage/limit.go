@@ -0,0 +1,95 @@
+package usage
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Limit describes how many times and until when something (rule) can be used. Zero MaxMatches means unlimited
+// number of matches and zero ExpiresAt means limit never expires
+type Limit struct {
+	MaxMatches  int64
+	MatchesLeft int64
+	ExpiresAt   time.Time
+}
+
+// New creates limit from maximum number of matches and TTL (duration string). Empty TTL never expires
+func New(maxMatches int64, ttl string) (Limit, error) {
+	if maxMatches < 0 {
+		return Limit{}, errors.New("max_matches can not be negative")
+	}
+	expiresAt, err := ExpiryFromTTL(ttl)
+	if err != nil {
+		return Limit{}, err
+	}
+	return Limit{
+		MaxMatches:  maxMatches,
+		MatchesLeft: maxMatches,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// Restore creates limit from its previously returned state (for example rule sent back through API). Remaining
+// matches and expiry time are kept so that limit is not reset. Zero remainingMatches and expiresAt are treated as not
+// given and limit is created from maxMatches and ttl instead
+func Restore(maxMatches int64, remainingMatches int64, expiresAt time.Time, ttl string) (Limit, error) {
+	if !expiresAt.IsZero() && ttl != "" {
+		return Limit{}, errors.New("ttl and expires_at can not be both set")
+	}
+	result, err := New(maxMatches, ttl)
+	if err != nil {
+		return Limit{}, err
+	}
+	if !expiresAt.IsZero() {
+		result.ExpiresAt = expiresAt
+	}
+	if remainingMatches != 0 {
+		if remainingMatches < 0 || remainingMatches > maxMatches {
+			return Limit{}, errors.New("remaining_matches must be between 1 and max_matches")
+		}
+		result.MatchesLeft = remainingMatches
+	}
+	return result, nil
+}
+
+// ExpiryFromTTL returns time when limit with given TTL (duration string) expires. Empty TTL results zero time (never)
+func ExpiryFromTTL(ttl string) (time.Time, error) {
+	if ttl == "" {
+		return time.Time{}, nil
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse rule ttl to duration")
+	}
+	if duration <= 0 {
+		return time.Time{}, errors.New("rule ttl must be positive duration")
+	}
+	return time.Now().Add(duration), nil
+}
+
+// IsExpired returns true when TTL has passed at given time
+func (l Limit) IsExpired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// IsLimited returns true when number of matches is limited
+func (l Limit) IsLimited() bool {
+	return l.MaxMatches > 0
+}
+
+// IsExhausted returns true when limited number of matches has run out
+func (l Limit) IsExhausted() bool {
+	return l.IsLimited() && l.MatchesLeft <= 0
+}
+
+// Use uses single match at given time. Returns false when limit has expired or is exhausted. Limit that becomes
+// exhausted with this use is still usable this time (see IsExhausted)
+func (l *Limit) Use(now time.Time) bool {
+	if l.IsExpired(now) || l.IsExhausted() {
+		return false
+	}
+	if l.IsLimited() {
+		l.MatchesLeft--
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package usage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	l, err := New(2, "1h")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), l.MatchesLeft)
+	assert.True(t, l.ExpiresAt.After(time.Now().Add(59*time.Minute)))
+
+	_, err = New(-1, "")
+	assert.EqualError(t, err, "max_matches can not be negative")
+
+	_, err = New(0, "-1s")
+	assert.EqualError(t, err, "rule ttl must be positive duration")
+}
+
+func TestRestore(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l, err := Restore(5, 2, expiresAt, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{MaxMatches: 5, MatchesLeft: 2, ExpiresAt: expiresAt}, l)
+
+	l, err = Restore(5, 0, time.Time{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{MaxMatches: 5, MatchesLeft: 5}, l)
+
+	_, err = Restore(5, 6, time.Time{}, "")
+	assert.EqualError(t, err, "remaining_matches must be between 1 and max_matches")
+
+	_, err = Restore(0, 0, expiresAt, "1h")
+	assert.EqualError(t, err, "ttl and expires_at can not be both set")
+}
+
+func TestLimitUse(t *testing.T) {
+	now := time.Now()
+	l := Limit{MaxMatches: 2, MatchesLeft: 2}
+
+	assert.True(t, l.Use(now))
+	assert.False(t, l.IsExhausted())
+	assert.True(t, l.Use(now))
+	assert.True(t, l.IsExhausted())
+	assert.False(t, l.Use(now))
+
+	unlimited := Limit{}
+	for i := 0; i < 3; i++ {
+		assert.True(t, unlimited.Use(now))
+	}
+	assert.False(t, unlimited.IsExhausted())
+
+	expired := Limit{ExpiresAt: now.Add(-1 * time.Second)}
+	assert.False(t, expired.Use(now))
+}
@@ -0,0 +1,198 @@
+package xmldiff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// KindAdded marks element or attribute that exists only in actual document
+	KindAdded = "added"
+	// KindRemoved marks element or attribute that exists only in expected document
+	KindRemoved = "removed"
+	// KindChanged marks element, attribute or text that has different value in documents
+	KindChanged = "changed"
+)
+
+// Difference is single difference between two XML documents
+type Difference struct {
+	// Path is location of difference in document (for example: /Envelope/Body/RR456Response/Isik[2]/@id)
+	Path     string
+	Kind     string
+	Expected string
+	Actual   string
+}
+
+type node struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*node
+}
+
+// Compare compares two XML documents and returns their differences. Elements and attributes are compared by their
+// local names (namespace prefixes are ignored), text is compared with surrounding whitespace trimmed and children
+// are compared in document order. Documents that can not be parsed as XML are compared as text.
+func Compare(expected []byte, actual []byte) []Difference {
+	expectedRoot, errExpected := parse(expected)
+	actualRoot, errActual := parse(actual)
+	if errExpected != nil || errActual != nil {
+		if bytes.Equal(expected, actual) {
+			return nil
+		}
+		return []Difference{{Path: "/", Kind: KindChanged, Expected: string(expected), Actual: string(actual)}}
+	}
+
+	var result []Difference
+	compareNodes("/"+expectedRoot.name, expectedRoot, actualRoot, &result)
+	return result
+}
+
+func parse(data []byte) (*node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	var root *node
+	var stack []*node
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse XML document")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local, attrs: map[string]string{}}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+					continue // namespace declarations are not content
+				}
+				n.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				current := stack[len(stack)-1]
+				current.text = strings.TrimSpace(current.text)
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("XML document has no root element")
+	}
+	return root, nil
+}
+
+// compareNodes compares elements at given path (path includes element name)
+func compareNodes(path string, expected *node, actual *node, result *[]Difference) {
+	if expected.name != actual.name {
+		*result = append(*result, Difference{
+			Path:     path,
+			Kind:     KindChanged,
+			Expected: expected.name,
+			Actual:   actual.name,
+		})
+		return
+	}
+
+	for _, name := range attributeNames(expected, actual) {
+		expectedValue, inExpected := expected.attrs[name]
+		actualValue, inActual := actual.attrs[name]
+		switch {
+		case !inActual:
+			*result = append(*result, Difference{Path: path + "/@" + name, Kind: KindRemoved, Expected: expectedValue})
+		case !inExpected:
+			*result = append(*result, Difference{Path: path + "/@" + name, Kind: KindAdded, Actual: actualValue})
+		case expectedValue != actualValue:
+			*result = append(*result, Difference{
+				Path:     path + "/@" + name,
+				Kind:     KindChanged,
+				Expected: expectedValue,
+				Actual:   actualValue,
+			})
+		}
+	}
+
+	if expected.text != actual.text {
+		*result = append(*result, Difference{
+			Path:     path + "/text()",
+			Kind:     KindChanged,
+			Expected: expected.text,
+			Actual:   actual.text,
+		})
+	}
+
+	expectedPaths := childPaths(expected.children)
+	actualPaths := childPaths(actual.children)
+	for i := 0; i < len(expected.children) || i < len(actual.children); i++ {
+		switch {
+		case i >= len(actual.children):
+			*result = append(*result, Difference{
+				Path:     path + "/" + expectedPaths[i],
+				Kind:     KindRemoved,
+				Expected: expected.children[i].text,
+			})
+		case i >= len(expected.children):
+			*result = append(*result, Difference{
+				Path:   path + "/" + actualPaths[i],
+				Kind:   KindAdded,
+				Actual: actual.children[i].text,
+			})
+		default:
+			compareNodes(path+"/"+expectedPaths[i], expected.children[i], actual.children[i], result)
+		}
+	}
+}
+
+func attributeNames(expected *node, actual *node) []string {
+	names := make([]string, 0, len(expected.attrs)+len(actual.attrs))
+	for name := range expected.attrs {
+		names = append(names, name)
+	}
+	for name := range actual.attrs {
+		if _, ok := expected.attrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// childPaths returns path segments for children. Repeated sibling elements get 1-based index (for example: Isik[2])
+func childPaths(children []*node) []string {
+	counts := map[string]int{}
+	for _, c := range children {
+		counts[c.name]++
+	}
+
+	seen := map[string]int{}
+	result := make([]string, len(children))
+	for i, c := range children {
+		seen[c.name]++
+		if counts[c.name] > 1 {
+			result[i] = fmt.Sprintf("%v[%v]", c.name, seen[c.name])
+			continue
+		}
+		result[i] = c.name
+	}
+	return result
+}
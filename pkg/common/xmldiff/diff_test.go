@@ -0,0 +1,62 @@
+package xmldiff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		expected string
+		actual   string
+		result   []Difference
+	}{
+		{
+			name:     "ok, equal ignoring prefixes and whitespace",
+			expected: `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body><a>1</a></SOAP-ENV:Body></SOAP-ENV:Envelope>`,
+			actual: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+    <soap:Body>
+        <a> 1 </a>
+    </soap:Body>
+</soap:Envelope>`,
+		},
+		{
+			name:     "ok, changed text",
+			expected: `<r><isik><nimi>Mari</nimi></isik></r>`,
+			actual:   `<r><isik><nimi>Jaan</nimi></isik></r>`,
+			result:   []Difference{{Path: "/r/isik/nimi/text()", Kind: KindChanged, Expected: "Mari", Actual: "Jaan"}},
+		},
+		{
+			name:     "ok, repeated elements and attributes",
+			expected: `<r><isik id="1"/><isik id="2"/></r>`,
+			actual:   `<r><isik id="1"/><isik id="3" new="x"/><isik id="4"/></r>`,
+			result: []Difference{
+				{Path: "/r/isik[2]/@id", Kind: KindChanged, Expected: "2", Actual: "3"},
+				{Path: "/r/isik[2]/@new", Kind: KindAdded, Actual: "x"},
+				{Path: "/r/isik[3]", Kind: KindAdded},
+			},
+		},
+		{
+			name:     "ok, removed and renamed elements",
+			expected: `<r><a/><b/></r>`,
+			actual:   `<r><c/></r>`,
+			result: []Difference{
+				{Path: "/r/a", Kind: KindChanged, Expected: "a", Actual: "c"},
+				{Path: "/r/b", Kind: KindRemoved},
+			},
+		},
+		{
+			name:     "ok, not XML is compared as text",
+			expected: `<r>`,
+			actual:   `Bad Gateway`,
+			result:   []Difference{{Path: "/", Kind: KindChanged, Expected: "<r>", Actual: "Bad Gateway"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.result, Compare([]byte(tc.expected), []byte(tc.actual)))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package xmldoc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/antchfx/xmlquery"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+	"io"
+	"regexp"
+)
+
+const (
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+	xmlnsNamespace = "http://www.w3.org/2000/xmlns/"
+)
+
+var procInstAttr = regexp.MustCompile(`([\w:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Parse parses XML document into node tree. Unlike xmlquery parser it keeps prefixes of elements and attributes as
+// they are written in document and resolves namespace URIs from declarations in scope of each element. This way
+// same namespace bound to different prefixes in different parts of document survives when document is written back
+// with Output
+func Parse(body []byte) (*xmlquery.Node, error) {
+	doc := &xmlquery.Node{Type: xmlquery.DocumentNode}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	parent := doc
+	scopes := []map[string]string{{"xml": xmlNamespace, "xmlns": xmlnsNamespace}}
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			scope := declaredNamespaces(scopes[len(scopes)-1], t.Attr)
+			scopes = append(scopes, scope)
+
+			n := &xmlquery.Node{
+				Type:         xmlquery.ElementNode,
+				Data:         t.Name.Local,
+				Prefix:       t.Name.Space,
+				NamespaceURI: scope[t.Name.Space],
+				Attr:         make([]xmlquery.Attr, len(t.Attr)),
+			}
+			for i, a := range t.Attr {
+				n.Attr[i] = xmlquery.Attr{Name: a.Name, Value: a.Value, NamespaceURI: attrNamespace(scope, a.Name)}
+			}
+			xmlquery.AddChild(parent, n)
+			parent = n
+		case xml.EndElement:
+			if parent.Type != xmlquery.ElementNode || parent.Prefix != t.Name.Space || parent.Data != t.Name.Local {
+				return nil, errors.Errorf("unexpected end element </%v>", qualifiedName(t.Name.Space, t.Name.Local))
+			}
+			scopes = scopes[:len(scopes)-1]
+			parent = parent.Parent
+		case xml.CharData:
+			nodeType := xmlquery.TextNode
+			if offset < int64(len(body)) && bytes.HasPrefix(body[offset:], []byte("<![CDATA[")) {
+				nodeType = xmlquery.CharDataNode
+			}
+			xmlquery.AddChild(parent, &xmlquery.Node{Type: nodeType, Data: string(t)})
+		case xml.Comment:
+			xmlquery.AddChild(parent, &xmlquery.Node{Type: xmlquery.CommentNode, Data: string(t)})
+		case xml.ProcInst:
+			n := &xmlquery.Node{Type: xmlquery.DeclarationNode, Data: t.Target}
+			for _, m := range procInstAttr.FindAllStringSubmatch(string(t.Inst), -1) {
+				n.Attr = append(n.Attr, xmlquery.Attr{Name: xml.Name{Local: m[1]}, Value: m[2] + m[3]})
+			}
+			xmlquery.AddChild(parent, n)
+		}
+	}
+	if parent != doc {
+		return nil, errors.Errorf("unexpected EOF, element <%v> is not closed", qualifiedName(parent.Prefix, parent.Data))
+	}
+	return doc, nil
+}
+
+// declaredNamespaces returns prefix to namespace URI mapping of element. Default namespace has empty prefix
+func declaredNamespaces(parent map[string]string, attrs []xml.Attr) map[string]string {
+	var scope map[string]string
+	for _, a := range attrs {
+		prefix, ok := "", false
+		if a.Name.Space == "" && a.Name.Local == "xmlns" {
+			ok = true
+		} else if a.Name.Space == "xmlns" {
+			prefix, ok = a.Name.Local, true
+		}
+		if !ok {
+			continue
+		}
+		if scope == nil {
+			scope = make(map[string]string, len(parent)+1)
+			for k, v := range parent {
+				scope[k] = v
+			}
+		}
+		scope[prefix] = a.Value
+	}
+	if scope == nil {
+		return parent
+	}
+	return scope
+}
+
+// attrNamespace resolves namespace URI of attribute. Unprefixed attributes are not in default namespace
+func attrNamespace(scope map[string]string, name xml.Name) string {
+	if name.Space == "" {
+		if name.Local == "xmlns" {
+			return xmlnsNamespace
+		}
+		return ""
+	}
+	return scope[name.Space]
+}
+
+func qualifiedName(prefix string, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
@@ -0,0 +1,293 @@
+package xmldoc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+const (
+	// RewriteSet sets text of selected elements or value of selected attributes
+	RewriteSet = "set"
+	// RewriteRemove removes selected elements, attributes or text nodes
+	RewriteRemove = "remove"
+	// RewriteInsert inserts XML fragment as last child of selected elements
+	RewriteInsert = "insert"
+	// RewriteRenamePrefix renames namespace prefix within selected elements (including their namespace declarations)
+	RewriteRenamePrefix = "rename_prefix"
+)
+
+// Rewrite is structured modification of document nodes selected by XPath expression. Unlike regex replacement it
+// does not depend on attribute order or formatting of document
+type Rewrite struct {
+	Operation  string
+	Expression Expression
+	// Value is new text/attribute value for `set`, XML fragment for `insert` and new prefix for `rename_prefix`
+	Value string
+	// Prefix is namespace prefix renamed by `rename_prefix`
+	Prefix string
+}
+
+// target is node selected by rewrite expression. Attribute is identified by its name within owner element
+type target struct {
+	node *xmlquery.Node
+	attr *xml.Name
+}
+
+// NewRewrite creates rewrite with given operation. Expression defaults to document root for `rename_prefix`
+func NewRewrite(operation string, expr string, value string, prefix string) (Rewrite, error) {
+	if operation == "" {
+		operation = RewriteSet
+	}
+	switch operation {
+	case RewriteSet, RewriteRemove:
+	case RewriteInsert:
+		if err := validateFragment(value); err != nil {
+			return Rewrite{}, err
+		}
+	case RewriteRenamePrefix:
+		if prefix == "" || value == "" {
+			return Rewrite{}, errors.New("rename_prefix rewrite needs prefix and new prefix as value")
+		}
+		if expr == "" {
+			expr = "/"
+		}
+	default:
+		return Rewrite{}, errors.Errorf("invalid rewrite operation '%v', expected 'set', 'remove', 'insert' or 'rename_prefix'", operation)
+	}
+
+	compiled, err := Compile(expr)
+	if err != nil {
+		return Rewrite{}, err
+	}
+	return Rewrite{
+		Operation:  operation,
+		Expression: compiled,
+		Value:      value,
+		Prefix:     prefix,
+	}, nil
+}
+
+// Apply applies rewrite to document and returns rewritten document. Document that can not be parsed as XML is
+// returned as is
+func (r Rewrite) Apply(body []byte) ([]byte, error) {
+	root, err := NewDocument(body).Root()
+	if err != nil {
+		return body, err
+	}
+
+	targets := r.selectTargets(root)
+	if len(targets) == 0 {
+		return body, nil
+	}
+	for _, t := range targets {
+		if err := r.apply(t); err != nil {
+			return body, err
+		}
+	}
+	return Output(root), nil
+}
+
+// selectTargets collects selected nodes before any of them is modified as modifications would confuse iterator
+func (r Rewrite) selectTargets(root *xmlquery.Node) []target {
+	result := make([]target, 0)
+	iterator := r.Expression.expr.Select(xmlquery.CreateXPathNavigator(root))
+	for iterator.MoveNext() {
+		nav, ok := iterator.Current().(*xmlquery.NodeNavigator)
+		if !ok {
+			continue
+		}
+		t := target{node: nav.Current()}
+		if nav.NodeType() == xpath.AttributeNode {
+			t.attr = &xml.Name{Space: nav.Prefix(), Local: nav.LocalName()}
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+func (r Rewrite) apply(t target) error {
+	if t.attr != nil {
+		r.applyToAttribute(t.node, *t.attr)
+		return nil
+	}
+
+	n := t.node
+	switch r.Operation {
+	case RewriteSet:
+		switch n.Type {
+		case xmlquery.TextNode, xmlquery.CharDataNode, xmlquery.CommentNode:
+			n.Data = r.Value
+		case xmlquery.ElementNode:
+			for child := n.FirstChild; child != nil; child = n.FirstChild {
+				xmlquery.RemoveFromTree(child)
+			}
+			xmlquery.AddChild(n, &xmlquery.Node{Type: xmlquery.TextNode, Data: r.Value})
+		}
+	case RewriteRemove:
+		xmlquery.RemoveFromTree(n)
+	case RewriteInsert:
+		if n.Type != xmlquery.ElementNode {
+			return nil
+		}
+		nodes, err := parseFragment(r.Value, n)
+		if err != nil {
+			return err
+		}
+		for _, child := range nodes {
+			xmlquery.AddChild(n, child)
+		}
+	case RewriteRenamePrefix:
+		renamePrefix(n, r.Prefix, r.Value)
+	}
+	return nil
+}
+
+func (r Rewrite) applyToAttribute(n *xmlquery.Node, name xml.Name) {
+	for i, a := range n.Attr {
+		if a.Name != name {
+			continue
+		}
+		switch r.Operation {
+		case RewriteSet:
+			n.Attr[i].Value = r.Value
+		case RewriteRemove:
+			n.Attr = append(n.Attr[:i:i], n.Attr[i+1:]...)
+		}
+		return
+	}
+}
+
+func renamePrefix(n *xmlquery.Node, from string, to string) {
+	if n.Type == xmlquery.ElementNode {
+		if n.Prefix == from {
+			n.Prefix = to
+		}
+		for i, a := range n.Attr {
+			if a.Name.Space == "xmlns" && a.Name.Local == from {
+				n.Attr[i].Name.Local = to
+			} else if a.Name.Space == from {
+				n.Attr[i].Name.Space = to
+			}
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		renamePrefix(child, from, to)
+	}
+}
+
+// validateFragment checks that fragment is well-formed XML. Namespace prefixes are resolved only when fragment is
+// inserted into document
+func validateFragment(fragment string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to parse XML fragment")
+		}
+	}
+}
+
+// parseFragment parses XML fragment into nodes. Namespace prefixes declared in scope of given parent element can be
+// used in fragment
+func parseFragment(fragment string, parent *xmlquery.Node) ([]*xmlquery.Node, error) {
+	var wrapper strings.Builder
+	wrapper.WriteString("<fragment")
+	declared := map[string]bool{}
+	for n := parent; n != nil; n = n.Parent {
+		for _, a := range n.Attr {
+			if a.Name.Space == "xmlns" && !declared[a.Name.Local] {
+				declared[a.Name.Local] = true
+				wrapper.WriteString(" xmlns:" + a.Name.Local + `="` + escapeAttr(a.Value) + `"`)
+			}
+		}
+	}
+	wrapper.WriteString(">" + fragment + "</fragment>")
+
+	doc, err := Parse([]byte(wrapper.String()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse XML fragment")
+	}
+	root := doc.SelectElement("fragment")
+	if root == nil {
+		return nil, errors.New("failed to parse XML fragment")
+	}
+
+	result := make([]*xmlquery.Node, 0)
+	for child := root.FirstChild; child != nil; child = root.FirstChild {
+		xmlquery.RemoveFromTree(child)
+		result = append(result, child)
+	}
+	return result, nil
+}
+
+// Output serializes document back to XML. Text is written as is so formatting of document is preserved. Elements
+// and attributes are written with prefixes they were parsed with (see Parse)
+func Output(root *xmlquery.Node) []byte {
+	var buf bytes.Buffer
+	output(&buf, root)
+	return buf.Bytes()
+}
+
+func output(buf *bytes.Buffer, n *xmlquery.Node) {
+	switch n.Type {
+	case xmlquery.DocumentNode:
+		outputChildren(buf, n)
+	case xmlquery.DeclarationNode:
+		buf.WriteString("<?" + n.Data)
+		for _, a := range n.Attr {
+			buf.WriteString(" " + a.Name.Local + `="` + escapeAttr(a.Value) + `"`)
+		}
+		buf.WriteString("?>")
+	case xmlquery.TextNode:
+		buf.WriteString(escapeText(n.Data))
+	case xmlquery.CharDataNode:
+		buf.WriteString("<![CDATA[" + n.Data + "]]>")
+	case xmlquery.CommentNode:
+		buf.WriteString("<!--" + n.Data + "-->")
+	case xmlquery.ElementNode:
+		name := n.Data
+		if n.Prefix != "" {
+			name = n.Prefix + ":" + n.Data
+		}
+		buf.WriteString("<" + name)
+		for _, a := range n.Attr {
+			attrName := a.Name.Local
+			if a.Name.Space != "" {
+				attrName = a.Name.Space + ":" + a.Name.Local
+			}
+			buf.WriteString(" " + attrName + `="` + escapeAttr(a.Value) + `"`)
+		}
+		if n.FirstChild == nil {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteString(">")
+		outputChildren(buf, n)
+		buf.WriteString("</" + name + ">")
+	}
+}
+
+func outputChildren(buf *bytes.Buffer, n *xmlquery.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		output(buf, child)
+	}
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+func escapeAttr(value string) string {
+	return attrEscaper.Replace(value)
+}
@@ -0,0 +1,143 @@
+package xmldoc
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const rewriteBody = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:prod="http://rr.x-road.eu/producer">
+    <SOAP-ENV:Body>
+        <prod:RR456Response>
+            <response>
+                <Isik id="1" nr="A &amp; B"><Isikukood>38211020380</Isikukood></Isik>
+                <Isik id="2"><Isikukood>48211020380</Isikukood></Isik>
+            </response>
+        </prod:RR456Response>
+    </SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+func TestRewriteApply(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		operation string
+		xpath     string
+		value     string
+		prefix    string
+		expected  string
+	}{
+		{
+			name:     "ok, set element text",
+			xpath:    "//*[local-name()='Isikukood'][starts-with(., '4')]",
+			value:    "49001010000",
+			expected: `<Isik id="2"><Isikukood>49001010000</Isikukood></Isik>`,
+		},
+		{
+			name:      "ok, set attribute value",
+			operation: RewriteSet,
+			xpath:     "//Isik[@id='1']/@nr",
+			value:     `"quoted"`,
+			expected:  `<Isik id="1" nr="&quot;quoted&quot;"><Isikukood>38211020380</Isikukood></Isik>`,
+		},
+		{
+			name:      "ok, remove element",
+			operation: RewriteRemove,
+			xpath:     "//Isik[@id='2']",
+			expected: `<Isik id="1" nr="A &amp; B"><Isikukood>38211020380</Isikukood></Isik>
+                
+            </response>`,
+		},
+		{
+			name:      "ok, remove attribute",
+			operation: RewriteRemove,
+			xpath:     "//Isik/@nr",
+			expected:  `<Isik id="1"><Isikukood>38211020380</Isikukood></Isik>`,
+		},
+		{
+			name:      "ok, insert fragment",
+			operation: RewriteInsert,
+			xpath:     "//Isik[@id='2']",
+			value:     `<Nimi>Mari</Nimi><prod:Staatus>elus</prod:Staatus>`,
+			expected:  `<Isik id="2"><Isikukood>48211020380</Isikukood><Nimi>Mari</Nimi><prod:Staatus>elus</prod:Staatus></Isik>`,
+		},
+		{
+			name:      "ok, rename prefix",
+			operation: RewriteRenamePrefix,
+			prefix:    "SOAP-ENV",
+			value:     "soapenv",
+			expected:  `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:prod="http://rr.x-road.eu/producer">`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rewrite, err := NewRewrite(tc.operation, tc.xpath, tc.value, tc.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := rewrite.Apply([]byte(rewriteBody))
+
+			assert.NoError(t, err)
+			assert.Contains(t, string(result), tc.expected)
+			assert.Contains(t, string(result), `<?xml version="1.0" encoding="UTF-8"?>`)
+		})
+	}
+}
+
+func TestRewritePreservesDocument(t *testing.T) {
+	rewrite, err := NewRewrite(RewriteSet, "//Isik[@id='3']", "x", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rewrite.Apply([]byte(rewriteBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, rewriteBody, string(result))
+}
+
+func TestNewRewriteInvalid(t *testing.T) {
+	_, err := NewRewrite("replace", "//a", "", "")
+	assert.EqualError(t, err, "invalid rewrite operation 'replace', expected 'set', 'remove', 'insert' or 'rename_prefix'")
+
+	_, err = NewRewrite(RewriteRenamePrefix, "", "soapenv", "")
+	assert.EqualError(t, err, "rename_prefix rewrite needs prefix and new prefix as value")
+
+	_, err = NewRewrite(RewriteInsert, "//a", "<b>", "")
+	assert.EqualError(t, err, "failed to parse XML fragment: XML syntax error on line 1: element <b> closed by </fragment>")
+}
+
+func TestRewriteKeepsPrefixesOfSameNamespace(t *testing.T) {
+	// same namespace is bound to `iden` in envelope and to `id` in client element
+	body := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:iden="http://x-road.eu/xsd/identifiers" xmlns:xro="http://x-road.eu/xsd/xroad.xsd">
+  <s:Header>
+    <xro:client id:objectType="SUBSYSTEM" xmlns:id="http://x-road.eu/xsd/identifiers">
+      <id:xRoadInstance>ee-test</id:xRoadInstance>
+    </xro:client>
+    <xro:service iden:objectType="SERVICE">
+      <iden:xRoadInstance>ee-test</iden:xRoadInstance>
+      <![CDATA[<kept>]]>
+    </xro:service>
+  </s:Header>
+</s:Envelope>`
+	rewrite, err := NewRewrite(RewriteSet, "//*[local-name()='xRoadInstance']", "ee-dev", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rewrite.Apply([]byte(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:iden="http://x-road.eu/xsd/identifiers" xmlns:xro="http://x-road.eu/xsd/xroad.xsd">
+  <s:Header>
+    <xro:client id:objectType="SUBSYSTEM" xmlns:id="http://x-road.eu/xsd/identifiers">
+      <id:xRoadInstance>ee-dev</id:xRoadInstance>
+    </xro:client>
+    <xro:service iden:objectType="SERVICE">
+      <iden:xRoadInstance>ee-dev</iden:xRoadInstance>
+      <![CDATA[<kept>]]>
+    </xro:service>
+  </s:Header>
+</s:Envelope>`, string(result))
+}
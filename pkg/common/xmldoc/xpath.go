@@ -0,0 +1,97 @@
+package xmldoc
+
+import (
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/pkg/errors"
+)
+
+// Expressions is collection type for Expression structures
+type Expressions []Expression
+
+// Namespaces maps namespace prefixes used in XPath expressions to namespace URIs
+type Namespaces map[string]string
+
+// Expression is compiled XPath expression used to match XML documents.
+// Prefixes bound in namespaces expression was compiled with match by namespace URI so `//iden:code` compiled with
+// `iden: http://x-road.eu/xsd/identifiers` matches also `id:code` element when document binds `id` to same URI.
+// Prefixes that are not bound match only when document uses exactly the same prefix. Use `local-name()` function to
+// match elements regardless of their namespace, for example `//*[local-name()='Isikukood'][starts-with(., '382')]`
+type Expression struct {
+	expr *xpath.Expr
+}
+
+// Document is XML document that is parsed on first access and is meant to be shared between multiple expressions
+type Document struct {
+	body   []byte
+	parsed bool
+	root   *xmlquery.Node
+	err    error
+}
+
+// NewDocument creates new lazily parsed document from given bytes
+func NewDocument(body []byte) *Document {
+	return &Document{body: body}
+}
+
+// Root returns parsed document root node
+func (d *Document) Root() (*xmlquery.Node, error) {
+	if !d.parsed {
+		d.parsed = true
+		d.root, d.err = Parse(d.body)
+		if d.err != nil {
+			d.err = errors.Wrap(d.err, "failed to parse XML document")
+		}
+	}
+	return d.root, d.err
+}
+
+// Compile compiles XPath expression without namespace bindings
+func Compile(expr string) (Expression, error) {
+	return CompileWithNamespaces(expr, nil)
+}
+
+// CompileWithNamespaces compiles XPath expression with prefixes bound to namespace URIs
+func CompileWithNamespaces(expr string, namespaces Namespaces) (Expression, error) {
+	compiled, err := xpath.CompileWithNS(expr, namespaces)
+	if err != nil {
+		return Expression{}, errors.Wrapf(err, "failed to compile XPath expression '%v'", expr)
+	}
+	return Expression{expr: compiled}, nil
+}
+
+// String returns source of the expression
+func (e Expression) String() string {
+	return e.expr.String()
+}
+
+// Match evaluates expression against document. Expression matches when its result is boolean true, non zero number,
+// non empty string or non empty node set. Document that can not be parsed as XML never matches.
+func (e Expression) Match(doc *Document) bool {
+	root, err := doc.Root()
+	if err != nil {
+		return false
+	}
+
+	switch result := e.expr.Evaluate(xmlquery.CreateXPathNavigator(root)).(type) {
+	case bool:
+		return result
+	case float64:
+		return result != 0
+	case string:
+		return result != ""
+	case *xpath.NodeIterator:
+		return result.MoveNext()
+	}
+	return false
+}
+
+// MatchAny returns true when any of the expressions matches the document
+func (e Expressions) MatchAny(doc *Document) bool {
+	for _, expr := range e {
+		if expr.Match(doc) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package xmldoc
+
+import (
+	test_test "github.com/aldas/xroad-mock-proxy/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpressionMatch(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{
+			name:     "element regardless of namespace prefix",
+			expr:     "//*[local-name()='Isikukood'][starts-with(., '382')]",
+			expected: true,
+		},
+		{
+			name:     "element value does not match",
+			expr:     "//*[local-name()='Isikukood'][starts-with(., '4')]",
+			expected: false,
+		},
+		{
+			name:     "boolean expression",
+			expr:     "count(//*[local-name()='client']/*) = 4",
+			expected: true,
+		},
+		{
+			name:     "namespace uri and attribute",
+			expr:     "//*[local-name()='service' and namespace-uri()='http://x-road.eu/xsd/xroad.xsd'][@*[local-name()='objectType']='SERVICE']",
+			expected: true,
+		},
+		{
+			name:     "string result",
+			expr:     "string(//*[local-name()='missing'])",
+			expected: false,
+		},
+	}
+
+	doc := NewDocument(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml"))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Compile(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tc.expected, expr.Match(doc))
+		})
+	}
+}
+
+func TestExpressionMatchInvalidDocument(t *testing.T) {
+	expr, err := Compile("//*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, expr.Match(NewDocument([]byte("not XML <"))))
+}
+
+func TestCompileInvalidExpression(t *testing.T) {
+	_, err := Compile("//*[")
+
+	assert.Error(t, err)
+}
+
+func TestExpressionMatchWithNamespaces(t *testing.T) {
+	doc := NewDocument([]byte(`<a xmlns:id="http://x-road.eu/xsd/identifiers"><id:code>382</id:code></a>`))
+
+	expr, err := CompileWithNamespaces("//iden:code[.='382']", Namespaces{"iden": "http://x-road.eu/xsd/identifiers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, expr.Match(doc))
+
+	otherNamespace, err := CompileWithNamespaces("//iden:code", Namespaces{"iden": "http://x-road.eu/xsd/producer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, otherNamespace.Match(doc))
+
+	unbound, err := Compile("//iden:code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, unbound.Match(doc))
+}
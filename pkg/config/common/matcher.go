@@ -0,0 +1,40 @@
+package common
+
+// HeaderMatcherConf describes X-road SOAP header field values request must have to match. Empty fields match anything
+type HeaderMatcherConf struct {
+	Client           ClientIdentifierConf `mapstructure:"client"`
+	UserID           string               `mapstructure:"user_id"`
+	RepresentedParty RepresentedPartyConf `mapstructure:"represented_party"`
+	Issue            string               `mapstructure:"issue"`
+	ProtocolVersion  string               `mapstructure:"protocol_version"`
+}
+
+// ClientIdentifierConf describes X-road client identifier (xro:client) parts
+type ClientIdentifierConf struct {
+	XRoadInstance string `mapstructure:"instance"`
+	MemberClass   string `mapstructure:"member_class"`
+	MemberCode    string `mapstructure:"member_code"`
+	SubsystemCode string `mapstructure:"subsystem_code"`
+}
+
+// RepresentedPartyConf describes X-road represented party (xro:representedParty) parts
+type RepresentedPartyConf struct {
+	PartyClass string `mapstructure:"party_class"`
+	PartyCode  string `mapstructure:"party_code"`
+}
+
+// MatcherConf describes composable matcher expression. Expression matches when all of its set conditions match:
+// every expression in `all`, at least one expression in `any`, `not` expression does not match and all leaf
+// conditions (service, header, regex, xpath, remote_addr) match
+type MatcherConf struct {
+	All []MatcherConf `mapstructure:"all"`
+	Any []MatcherConf `mapstructure:"any"`
+	Not *MatcherConf  `mapstructure:"not"`
+	// service in short (subsystemCode.serviceCode.serviceVersion) or full form (instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion)
+	Service string            `mapstructure:"service"`
+	Header  HeaderMatcherConf `mapstructure:"header"`
+	Regex   string            `mapstructure:"regex"`
+	XPath   string            `mapstructure:"xpath"`
+	// IPv4/IPv6 addresses or CIDR ranges
+	RemoteAddr []string `mapstructure:"remote_addr"`
+}
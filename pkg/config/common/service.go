@@ -0,0 +1,11 @@
+package common
+
+// ServiceIdentifierConf describes X-road service identifier (xro:service) parts. Empty parts match anything
+type ServiceIdentifierConf struct {
+	XRoadInstance  string `mapstructure:"instance"`
+	MemberClass    string `mapstructure:"member_class"`
+	MemberCode     string `mapstructure:"member_code"`
+	SubsystemCode  string `mapstructure:"subsystem_code"`
+	ServiceCode    string `mapstructure:"service_code"`
+	ServiceVersion string `mapstructure:"service_version"`
+}
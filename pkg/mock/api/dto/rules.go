@@ -3,6 +3,9 @@ package dto
 import (
 	"encoding/base64"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/dto"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/schedule"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/domain"
 	"github.com/pkg/errors"
 	"regexp"
@@ -12,15 +15,26 @@ import (
 
 // RuleDTO is DTO for rule
 type RuleDTO struct {
-	ID             int64    `json:"id"`
-	Service        string   `json:"service"`
-	Priority       int64    `json:"priority"`
-	MatcherRegex   []string `json:"matcher_regexes"`
-	IdentityRegex  string   `json:"identity_regex"`
-	Template       string   `json:"template"`
-	Timeout        string   `json:"timeout_duration"`
-	ResponseStatus int      `json:"response_status"`
-	IsReadOnly     bool     `json:"read_only"`
+	ID                int64             `json:"id"`
+	Service           string            `json:"service"`
+	Priority          int64             `json:"priority"`
+	MatcherRegex      []string          `json:"matcher_regexes"`
+	MatcherXPath      []string          `json:"matcher_xpaths"`
+	MatcherNamespaces map[string]string `json:"matcher_namespaces,omitempty"`
+	Matcher           *dto.MatcherDTO   `json:"matcher,omitempty"`
+	IdentityRegex     string            `json:"identity_regex"`
+	Template          string            `json:"template"`
+	Timeout           string            `json:"timeout_duration"`
+	ResponseStatus    int               `json:"response_status"`
+	Scenario          string            `json:"scenario,omitempty"`
+	ActiveFrom        string            `json:"active_from,omitempty"`
+	ActiveUntil       string            `json:"active_until,omitempty"`
+	ActiveWindows     []string          `json:"active_windows,omitempty"`
+	MaxMatches        int64             `json:"max_matches,omitempty"`
+	RemainingMatches  int64             `json:"remaining_matches,omitempty"`
+	TTL               string            `json:"ttl,omitempty"`
+	ExpiresAt         *time.Time        `json:"expires_at,omitempty"`
+	IsReadOnly        bool              `json:"read_only"`
 }
 
 // RulesToDTO converts slice of rules to DTOs
@@ -39,14 +53,24 @@ func RuleToDTO(r domain.Rule) RuleDTO {
 		identityRegexpStr = r.IdentityRegex.String()
 	}
 	return RuleDTO{
-		ID:             r.ID,
-		Service:        r.Service,
-		Priority:       r.Priority,
-		MatcherRegex:   dto.RegExpToSlice(r.MatcherRegex),
-		IdentityRegex:  identityRegexpStr,
-		Timeout:        r.Timeout.String(),
-		ResponseStatus: r.ResponseStatus,
-		IsReadOnly:     r.IsReadOnly,
+		ID:                r.ID,
+		Service:           r.Service.String(),
+		Priority:          r.Priority,
+		MatcherRegex:      dto.RegExpToSlice(r.MatcherRegex),
+		MatcherXPath:      dto.XPathToSlice(r.MatcherXPath),
+		MatcherNamespaces: r.MatcherNamespaces,
+		Matcher:           dto.MatcherToDTO(r.Matcher),
+		IdentityRegex:     identityRegexpStr,
+		Timeout:           r.Timeout.String(),
+		ResponseStatus:    r.ResponseStatus,
+		Scenario:          r.Scenario,
+		ActiveFrom:        schedule.FormatTime(r.Schedule.From),
+		ActiveUntil:       schedule.FormatTime(r.Schedule.Until),
+		ActiveWindows:     r.Schedule.WindowSpecs(),
+		MaxMatches:        r.MaxMatches,
+		RemainingMatches:  r.MatchesLeft,
+		ExpiresAt:         expiresAtToDTO(r.ExpiresAt),
+		IsReadOnly:        r.IsReadOnly,
 	}
 }
 
@@ -58,15 +82,25 @@ func RuleToFullDTO(r domain.Rule) RuleDTO {
 	}
 
 	return RuleDTO{
-		ID:             r.ID,
-		Service:        r.Service,
-		Priority:       r.Priority,
-		IdentityRegex:  identityRegexpStr,
-		MatcherRegex:   dto.RegExpToSlice(r.MatcherRegex),
-		Template:       base64.StdEncoding.EncodeToString(r.TemplateBytes),
-		Timeout:        r.Timeout.String(),
-		ResponseStatus: r.ResponseStatus,
-		IsReadOnly:     r.IsReadOnly,
+		ID:                r.ID,
+		Service:           r.Service.String(),
+		Priority:          r.Priority,
+		IdentityRegex:     identityRegexpStr,
+		MatcherRegex:      dto.RegExpToSlice(r.MatcherRegex),
+		MatcherXPath:      dto.XPathToSlice(r.MatcherXPath),
+		MatcherNamespaces: r.MatcherNamespaces,
+		Matcher:           dto.MatcherToDTO(r.Matcher),
+		Template:          base64.StdEncoding.EncodeToString(r.TemplateBytes),
+		Timeout:           r.Timeout.String(),
+		ResponseStatus:    r.ResponseStatus,
+		Scenario:          r.Scenario,
+		ActiveFrom:        schedule.FormatTime(r.Schedule.From),
+		ActiveUntil:       schedule.FormatTime(r.Schedule.Until),
+		ActiveWindows:     r.Schedule.WindowSpecs(),
+		MaxMatches:        r.MaxMatches,
+		RemainingMatches:  r.MatchesLeft,
+		ExpiresAt:         expiresAtToDTO(r.ExpiresAt),
+		IsReadOnly:        r.IsReadOnly,
 	}
 }
 
@@ -90,11 +124,41 @@ func FullDTOToRule(r RuleDTO) (domain.Rule, error) {
 		responseStatus = r.ResponseStatus
 	}
 
+	service, err := soap.ParseRuleService(r.Service)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
 	matcherRegexps, err := dto.SliceToRegexp(r.MatcherRegex)
 	if err != nil {
 		return domain.Rule{}, err
 	}
 
+	matcherXPaths, err := dto.SliceToXPath(r.MatcherXPath, r.MatcherNamespaces)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	expression, err := dto.ToMatcher(r.Matcher, r.MatcherNamespaces)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	activeSchedule, err := schedule.Parse(r.ActiveFrom, r.ActiveUntil, r.ActiveWindows)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	var expiresAt time.Time
+	if r.ExpiresAt != nil {
+		expiresAt = *r.ExpiresAt
+	}
+	// rule returned by API (GET) and sent back (PUT) keeps its remaining matches and expiry time
+	limit, err := usage.Restore(r.MaxMatches, r.RemainingMatches, expiresAt, r.TTL)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
 	var identityRegex *regexp.Regexp
 	if r.IdentityRegex != "" {
 		irTmp, err := regexp.Compile(r.IdentityRegex)
@@ -110,18 +174,31 @@ func FullDTOToRule(r RuleDTO) (domain.Rule, error) {
 	}
 
 	return domain.Rule{
-		ID:             r.ID,
-		Service:        r.Service,
-		Priority:       r.Priority,
-		IdentityRegex:  identityRegex,
-		MatcherRegex:   matcherRegexps,
-		TemplateBytes:  tmplBytes,
-		Template:       *tmpl,
-		Timeout:        timeout,
-		ResponseStatus: responseStatus,
+		ID:                r.ID,
+		Service:           service,
+		Priority:          r.Priority,
+		IdentityRegex:     identityRegex,
+		MatcherRegex:      matcherRegexps,
+		MatcherXPath:      matcherXPaths,
+		MatcherNamespaces: r.MatcherNamespaces,
+		Matcher:           expression,
+		Schedule:          activeSchedule,
+		Scenario:          r.Scenario,
+		Limit:             limit,
+		TemplateBytes:     tmplBytes,
+		Template:          *tmpl,
+		Timeout:           timeout,
+		ResponseStatus:    responseStatus,
 	}, nil
 }
 
+func expiresAtToDTO(expiresAt time.Time) *time.Time {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return &expiresAt
+}
+
 func compileTemplate(base64Template string) (*template.Template, []byte, error) {
 	templateBytes, err := base64.StdEncoding.DecodeString(base64Template)
 	if err != nil {
@@ -17,6 +17,10 @@ type MockConf struct {
 	Rules               RuleConfigs          `mapstructure:"rules"`
 	WebAssetsDirectory  string               `mapstructure:"web_assets_directory"`
 	Storage             StorageConf          `mapstructure:"storage"`
+	// list of proxy addresses (IP or CIDR range) in front of mock that are trusted to set X-Forwarded-For and
+	// Forwarded headers. Client address for rule matching is resolved from these headers when request comes from
+	// trusted proxy.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // StorageConf describes rules storage configuration
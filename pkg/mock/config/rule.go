@@ -1,16 +1,31 @@
 package config
 
+import "github.com/aldas/xroad-mock-proxy/pkg/config/common"
+
 // RuleConfigs is collection type for RuleConf structure
 type RuleConfigs []RuleConf
 
 // RuleConf describes configuration for rules how to mock requests
 type RuleConf struct {
-	Service        string   `mapstructure:"service"`
-	Priority       int64    `mapstructure:"priority"`
-	MatcherRegex   []string `mapstructure:"matcher_regexes"`
-	IdentityRegex  string   `mapstructure:"identity_regex"`
-	TemplateFile   string   `mapstructure:"template_file"`
-	Timeout        string   `mapstructure:"timeout_duration"`
-	ResponseStatus int      `mapstructure:"response_status"`
-	IsReadOnly     *bool    `mapstructure:"read_only"`
+	// service to match in short form (subsystemCode.serviceCode.serviceVersion) (for example: rr.RR67_muutus.v1)
+	// or in full form (instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion)
+	Service string `mapstructure:"service"`
+	// service identifier to match by its parts. Alternative to `service`, omitted parts match any value
+	ServiceIdentifier common.ServiceIdentifierConf `mapstructure:"service_identifier"`
+	Priority          int64                        `mapstructure:"priority"`
+	MatcherRegex      []string                     `mapstructure:"matcher_regexes"`
+	MatcherXPath      []string                     `mapstructure:"matcher_xpaths"`
+	MatcherNamespaces map[string]string            `mapstructure:"matcher_namespaces"`
+	Matcher           common.MatcherConf           `mapstructure:"matcher"`
+	Scenario          string                       `mapstructure:"scenario"`
+	IdentityRegex     string                       `mapstructure:"identity_regex"`
+	TemplateFile      string                       `mapstructure:"template_file"`
+	Timeout           string                       `mapstructure:"timeout_duration"`
+	ResponseStatus    int                          `mapstructure:"response_status"`
+	ActiveFrom        string                       `mapstructure:"active_from"`
+	ActiveUntil       string                       `mapstructure:"active_until"`
+	ActiveWindows     []string                     `mapstructure:"active_windows"`
+	MaxMatches        int64                        `mapstructure:"max_matches"`
+	TTL               string                       `mapstructure:"ttl"`
+	IsReadOnly        *bool                        `mapstructure:"read_only"`
 }
@@ -1,13 +1,17 @@
 package domain
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/schedule"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/config"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"net/http"
 	"regexp"
 	"sort"
-	"strings"
 	"text/template"
 	"time"
 )
@@ -19,10 +23,17 @@ type Rules []Rule
 
 // Rule describes rules how to mock requests
 type Rule struct {
-	ID             int64
-	Service        string
-	Priority       int64
-	MatcherRegex   []*regexp.Regexp
+	ID           int64
+	Service      soap.ServiceIdentifier
+	Priority     int64
+	MatcherRegex []*regexp.Regexp
+	MatcherXPath xmldoc.Expressions
+	// MatcherNamespaces are namespace prefixes bound for XPath expressions of MatcherXPath and Matcher
+	MatcherNamespaces xmldoc.Namespaces
+	Matcher           matcher.Expression
+	Schedule          schedule.Schedule
+	Scenario          string
+	usage.Limit
 	IdentityRegex  *regexp.Regexp
 	Template       template.Template
 	TemplateBytes  []byte
@@ -57,6 +68,30 @@ func convertRule(r config.RuleConf) (Rule, error) {
 		matchers = append(matchers, matcher)
 	}
 
+	xpathMatchers := make(xmldoc.Expressions, 0)
+	for _, m := range r.MatcherXPath {
+		matcher, err := xmldoc.CompileWithNamespaces(m, r.MatcherNamespaces)
+		if err != nil {
+			return Rule{}, errors.Wrap(err, "failed to compile matcher XPath")
+		}
+		xpathMatchers = append(xpathMatchers, matcher)
+	}
+
+	service, err := soap.ConvertRuleService(r.Service, r.ServiceIdentifier)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	expression, err := matcher.FromConf(r.Matcher, r.MatcherNamespaces)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert matcher expression")
+	}
+
+	activeSchedule, err := schedule.Parse(r.ActiveFrom, r.ActiveUntil, r.ActiveWindows)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule schedule")
+	}
+
 	var identityRegex *regexp.Regexp
 	if r.IdentityRegex != "" {
 		tmpRegex, err := regexp.Compile(r.IdentityRegex)
@@ -83,21 +118,32 @@ func convertRule(r config.RuleConf) (Rule, error) {
 		r.ResponseStatus = http.StatusOK
 	}
 
+	limit, err := usage.New(r.MaxMatches, r.TTL)
+	if err != nil {
+		return Rule{}, err
+	}
+
 	isReadonly := true
 	if r.IsReadOnly != nil {
 		isReadonly = *r.IsReadOnly
 	}
 
 	return Rule{
-		Service:        strings.ToLower(r.Service),
-		Priority:       r.Priority,
-		MatcherRegex:   matchers,
-		IdentityRegex:  identityRegex,
-		Template:       *tmpl,
-		TemplateBytes:  tmplBytes,
-		Timeout:        timeout,
-		ResponseStatus: r.ResponseStatus,
-		IsReadOnly:     isReadonly,
+		Service:           service,
+		Priority:          r.Priority,
+		MatcherRegex:      matchers,
+		MatcherXPath:      xpathMatchers,
+		MatcherNamespaces: r.MatcherNamespaces,
+		Matcher:           expression,
+		Schedule:          activeSchedule,
+		Scenario:          r.Scenario,
+		Limit:             limit,
+		IdentityRegex:     identityRegex,
+		Template:          *tmpl,
+		TemplateBytes:     tmplBytes,
+		Timeout:           timeout,
+		ResponseStatus:    r.ResponseStatus,
+		IsReadOnly:        isReadonly,
 	}, nil
 }
 
@@ -115,31 +161,64 @@ func compileTemplate(templateFile string) (*template.Template, []byte, error) {
 	return tmpl, body, err
 }
 
-// MatchService returns slice of Rules matching given service name
-func (r Rules) MatchService(service string) Rules {
-	service = strings.ToLower(service)
+// MatchScenario returns slice of Rules bound to given test scenario. Empty scenario returns shared default rules
+func (r Rules) MatchScenario(scenario string) Rules {
+	result := make(Rules, 0)
+	for _, rule := range r {
+		if rule.Scenario == scenario {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// MatchActive returns slice of Rules that are active at given time
+func (r Rules) MatchActive(now time.Time) Rules {
+	result := make(Rules, 0)
+	for _, rule := range r {
+		if rule.Schedule.IsActive(now) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
 
+// MatchService returns slice of Rules matching given service identifier. Service parts are compared case-insensitively
+func (r Rules) MatchService(service soap.ServiceIdentifier) Rules {
 	result := make(Rules, 0)
 	for _, rule := range r {
-		if strings.ToLower(rule.Service) == service {
+		if rule.Service.MatchFold(service) {
 			result = append(result, rule)
 		}
 	}
 	return result
 }
 
-// MatchRegex returns first rule matching its regex
-func (r Rules) MatchRegex(requestBody []byte) (Rule, bool) {
+// MatchRequest returns first rule (in priority order) matching its regex, XPath and matcher expression
+func (r Rules) MatchRequest(request matcher.Request) (Rule, bool) {
 	sort.Sort(byPriorityDesc(r))
 	for _, rule := range r {
-		if rule.match(requestBody) {
+		if rule.match(request) {
 			return rule, true
 		}
 	}
 	return Rule{}, false
 }
 
-func (r Rule) match(requestBody []byte) bool {
+func (r Rule) match(request matcher.Request) bool {
+	return r.matchRegex(request.Body) &&
+		r.matchXPath(request.Document) &&
+		r.Matcher.Match(request)
+}
+
+func (r Rule) matchXPath(doc *xmldoc.Document) bool {
+	if len(r.MatcherXPath) == 0 {
+		return true
+	}
+	return r.MatcherXPath.MatchAny(doc)
+}
+
+func (r Rule) matchRegex(requestBody []byte) bool {
 	if len(r.MatcherRegex) == 0 {
 		return true
 	}
@@ -171,5 +250,9 @@ type byPriorityDesc Rules
 func (s byPriorityDesc) Len() int      { return len(s) }
 func (s byPriorityDesc) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 func (s byPriorityDesc) Less(i, j int) bool {
+	if s[i].Priority == s[j].Priority {
+		// with equal priorities more specific service (exact match over wildcard) wins
+		return s[i].Service.Specificity() > s[j].Service.Specificity()
+	}
 	return s[i].Priority > s[j].Priority
 }
@@ -2,6 +2,8 @@ package mock
 
 import (
 	"bytes"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
 	"github.com/labstack/echo"
 	"io/ioutil"
 )
@@ -12,19 +14,25 @@ const (
 )
 
 type controller struct {
-	srv Service
+	srv            Service
+	trustedProxies remoteaddr.Matcher
 }
 
-// RegisterRoutes registers mock routes with server
-func RegisterRoutes(srv Service, eg *echo.Group) {
-	h := controller{srv}
+// RegisterRoutes registers mock routes with server. Client address of requests coming from trusted proxies is taken
+// from X-Forwarded-For/Forwarded header
+func RegisterRoutes(srv Service, eg *echo.Group, trustedProxies remoteaddr.Matcher) {
+	h := controller{srv, trustedProxies}
 
 	eg.POST(XroadDefaulURL, h.mock)
 }
 
 // mock returns mocked SOAP response
 func (h *controller) mock(c echo.Context) error {
-	resp, statusCode := h.srv.mock(extractBody(c))
+	resp, statusCode := h.srv.mock(
+		extractBody(c),
+		remoteaddr.ClientIP(c.Request(), h.trustedProxies),
+		c.Request().Header.Get(matcher.ScenarioHeader),
+	)
 
 	return c.Blob(statusCode, "text/xml;charset=UTF-8", resp)
 }
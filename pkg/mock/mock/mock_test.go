@@ -1,8 +1,10 @@
 package mock
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,11 +12,13 @@ import (
 )
 
 type mockService struct {
-	Payload []byte
+	Payload  []byte
+	ClientIP net.IP
 }
 
-func (s *mockService) mock(requestBody []byte) ([]byte, int) {
+func (s *mockService) mock(requestBody []byte, clientIP net.IP, scenario string) ([]byte, int) {
 	s.Payload = requestBody
+	s.ClientIP = clientIP
 	return []byte("SOAP"), 200
 }
 
@@ -26,7 +30,7 @@ func TestMock(t *testing.T) {
 	c.SetPath(XroadDefaulURL)
 
 	service := mockService{}
-	h := &controller{&service}
+	h := &controller{srv: &service}
 
 	if assert.NoError(t, h.mock(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
@@ -35,3 +39,36 @@ func TestMock(t *testing.T) {
 		assert.Equal(t, "PAYLOAD", string(service.Payload))
 	}
 }
+
+func TestMockClientIPFromTrustedProxy(t *testing.T) {
+	trustedProxies, err := remoteaddr.Parse([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name       string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", expected: "192.168.1.5"},
+		{name: "untrusted proxy", remoteAddr: "172.16.0.1:1234", expected: "172.16.0.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, XroadDefaulURL, strings.NewReader("PAYLOAD"))
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Forwarded-For", "192.168.1.5")
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			service := mockService{}
+			h := &controller{srv: &service, trustedProxies: trustedProxies}
+
+			if assert.NoError(t, h.mock(c)) {
+				assert.Equal(t, tc.expected, service.ClientIP.String())
+			}
+		})
+	}
+}
@@ -2,17 +2,19 @@ package mock
 
 import (
 	"bytes"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/domain"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/rule"
 	"github.com/rs/zerolog"
+	"net"
 	"net/http"
 	"time"
 )
 
 // Service provides mock functionality
 type Service interface {
-	mock(requestBody []byte) ([]byte, int)
+	mock(requestBody []byte, clientIP net.IP, scenario string) ([]byte, int)
 }
 
 type service struct {
@@ -28,7 +30,7 @@ func NewService(logger *zerolog.Logger, storage rule.StorageGetter) Service {
 	}
 }
 
-func (s service) mock(requestBody []byte) ([]byte, int) {
+func (s service) mock(requestBody []byte, clientIP net.IP, scenario string) ([]byte, int) {
 	soapService, err := soap.FromRequestBody(requestBody)
 	if err != nil {
 		// TODO: handle multipart requests - detect from headers?
@@ -38,7 +40,7 @@ func (s service) mock(requestBody []byte) ([]byte, int) {
 	}
 	s.logger.Info().Str("service", soapService.Service).Msg("SOAP")
 
-	matchedRule, ok := s.storage.GetAll().MatchService(soapService.Service).MatchRegex(requestBody)
+	matchedRule, ok := s.matchRule(soapService.Header, requestBody, clientIP, scenario)
 	if !ok {
 		return []byte("Rule not found\n"), http.StatusNotFound
 	}
@@ -55,6 +57,38 @@ func (s service) mock(requestBody []byte) ([]byte, int) {
 	return s.processRule(matchedRule, identity)
 }
 
+// matchRule finds rule for request and marks it as used. Matching is repeated when matched rule ran out of matches
+// or expired meanwhile (concurrent request used it up)
+func (s service) matchRule(
+	header soap.Header,
+	requestBody []byte,
+	clientIP net.IP,
+	scenario string,
+) (domain.Rule, bool) {
+	request := matcher.NewRequest(header, requestBody, clientIP)
+	request.IgnoreServiceCase = true
+
+	for {
+		rules := s.storage.GetAll().
+			MatchActive(time.Now()).
+			MatchService(header.Service)
+
+		matchedRule, ok := domain.Rule{}, false
+		if scenario != "" {
+			matchedRule, ok = rules.MatchScenario(scenario).MatchRequest(request)
+		}
+		if !ok {
+			matchedRule, ok = rules.MatchScenario("").MatchRequest(request)
+		}
+		if !ok {
+			return domain.Rule{}, false
+		}
+		if usedRule, ok := s.storage.Use(matchedRule.ID); ok {
+			return usedRule, true
+		}
+	}
+}
+
 func (s service) processRule(matchedRule domain.Rule, identity string) ([]byte, int) {
 	vars := fromIdentity(identity)
 
@@ -6,6 +6,7 @@ import (
 	test_test "github.com/aldas/xroad-mock-proxy/test"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"net/http"
 	"os"
 	"testing"
@@ -23,7 +24,7 @@ func TestMockNoMatchingRules(t *testing.T) {
 	service := createTestService(config.RuleConfigs{})
 
 	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
-	bytes, status := service.mock(dataBytes)
+	bytes, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
 
 	assert.Equal(t, http.StatusNotFound, status)
 	assert.Equal(t, string(bytes), "Rule not found\n")
@@ -45,7 +46,7 @@ func TestMockMatchingRule(t *testing.T) {
 	}
 
 	service := createTestService(rules)
-	bytes, status := service.mock(dataBytes)
+	bytes, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
 
 	assert.Equal(t, http.StatusOK, status)
 	assert.Contains(t, string(bytes), "<Isik.Isikukood>38211020380</Isik.Isikukood>")
@@ -54,6 +55,131 @@ func TestMockMatchingRule(t *testing.T) {
 	assert.Contains(t, string(bytes), "<Isik.Sugu>M</Isik.Sugu>")
 }
 
+func TestMockMatchingRuleByXPath(t *testing.T) {
+	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+
+	rules := config.RuleConfigs{
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       2,
+			MatcherXPath:   []string{"//*[local-name()='Isikukood'][starts-with(., '999')]"},
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/not_found.xml",
+			ResponseStatus: 404,
+		},
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       1,
+			MatcherXPath:   []string{"//*[local-name()='Isikukood'][starts-with(., '382')]"},
+			IdentityRegex:  "(?mi)<isikukood>(\\d{11})<\\/isikukood>",
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/response.xml",
+			ResponseStatus: 200,
+		},
+	}
+
+	service := createTestService(rules)
+	bytes, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, string(bytes), "<Isik.Isikukood>38211020380</Isik.Isikukood>")
+}
+
+func TestMockExactServiceBeatsWildcard(t *testing.T) {
+	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+
+	rules := config.RuleConfigs{
+		config.RuleConf{
+			Service:        "rr.*",
+			Priority:       1,
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/not_found.xml",
+			ResponseStatus: 404,
+		},
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       1,
+			IdentityRegex:  "(?mi)<isikukood>(\\d{11})<\\/isikukood>",
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/response.xml",
+			ResponseStatus: 200,
+		},
+	}
+
+	service := createTestService(rules)
+	_, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
+
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestMockSkipsInactiveRule(t *testing.T) {
+	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+
+	rules := config.RuleConfigs{
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       1,
+			IdentityRegex:  "(?mi)<isikukood>(\\d{11})<\\/isikukood>",
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/response.xml",
+			ResponseStatus: 200,
+			ActiveUntil:    "2019-01-01T00:00:00Z",
+		},
+	}
+
+	service := createTestService(rules)
+	_, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
+
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestMockMatchingRuleByScenario(t *testing.T) {
+	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+
+	rules := config.RuleConfigs{
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       1,
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/not_found.xml",
+			ResponseStatus: 404,
+		},
+		config.RuleConf{
+			Service:        "rr.rr456.v1",
+			Priority:       1,
+			Scenario:       "ci-1",
+			IdentityRegex:  "(?mi)<isikukood>(\\d{11})<\\/isikukood>",
+			TemplateFile:   "../../../test/testdata/rr.rr456.v1/response.xml",
+			ResponseStatus: 200,
+		},
+	}
+	service := createTestService(rules)
+
+	_, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "ci-1")
+	assert.Equal(t, http.StatusOK, status)
+
+	_, status = service.mock(dataBytes, net.ParseIP("127.0.0.1"), "ci-2")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	_, status = service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestMockMatchingRuleByXPathWithNamespaces(t *testing.T) {
+	dataBytes := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+
+	rules := config.RuleConfigs{
+		config.RuleConf{
+			Service:  "rr.rr456.v1",
+			Priority: 1,
+			// request binds identifiers namespace to `iden` prefix
+			MatcherXPath:      []string{"//x:service/id:serviceCode[.='RR456']"},
+			MatcherNamespaces: map[string]string{"x": "http://x-road.eu/xsd/xroad.xsd", "id": "http://x-road.eu/xsd/identifiers"},
+			TemplateFile:      "../../../test/testdata/rr.rr456.v1/not_found.xml",
+			ResponseStatus:    http.StatusAccepted,
+		},
+	}
+
+	service := createTestService(rules)
+	_, status := service.mock(dataBytes, net.ParseIP("127.0.0.1"), "")
+
+	assert.Equal(t, http.StatusAccepted, status)
+}
+
 func createTestService(rules config.RuleConfigs) service {
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
@@ -83,3 +209,12 @@ func (s testStorage) GetAll() domain.Rules {
 func (s testStorage) GetRule(ID int64) (domain.Rule, bool) {
 	return domain.Rule{}, false
 }
+
+func (s testStorage) Use(ID int64) (domain.Rule, bool) {
+	for _, r := range s.Rules {
+		if r.ID == ID {
+			return r, true
+		}
+	}
+	return domain.Rule{}, false
+}
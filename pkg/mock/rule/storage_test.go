@@ -1,6 +1,7 @@
 package rule
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/domain"
 	"github.com/bluele/gcache"
 	"github.com/rs/zerolog"
@@ -34,3 +35,23 @@ func TestSaveExistingRule(t *testing.T) {
 	assert.Equal(t, r.ID, r2.ID)
 	assert.ObjectsAreEqual(r, r2)
 }
+
+func TestNewStorageDoesNotModifyGivenRules(t *testing.T) {
+	logger := zerolog.Nop()
+	rules := domain.Rules{
+		{ID: 1, Limit: usage.Limit{MaxMatches: 1, MatchesLeft: 1}},
+		{ID: 2, Limit: usage.Limit{MaxMatches: 2, MatchesLeft: 2}},
+	}
+	storage := NewStorage(&logger, rules, 10)
+
+	_, ok := storage.Use(1)
+	assert.True(t, ok)
+	_, ok = storage.Use(2)
+	assert.True(t, ok)
+
+	assert.Equal(t, domain.Rules{
+		{ID: 1, Limit: usage.Limit{MaxMatches: 1, MatchesLeft: 1}},
+		{ID: 2, Limit: usage.Limit{MaxMatches: 2, MatchesLeft: 2}},
+	}, rules)
+	assert.Len(t, storage.GetAll(), 1)
+}
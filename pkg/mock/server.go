@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/server"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/api"
 	"github.com/aldas/xroad-mock-proxy/pkg/mock/config"
@@ -39,9 +40,14 @@ func serve(logger *zerolog.Logger, conf config.MockConf) error {
 		return err
 	}
 
+	trustedProxies, err := remoteaddr.Parse(conf.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
 	storage := rule.NewStorage(logger, rules, conf.Storage.Size)
 
-	mock.RegisterRoutes(mock.NewService(logger, storage), rootGroup)
+	mock.RegisterRoutes(mock.NewService(logger, storage), rootGroup, trustedProxies)
 	api.RegisterRoutes(rule.NewService(logger, storage), rootGroup)
 
 	if conf.WebAssetsDirectory != "" {
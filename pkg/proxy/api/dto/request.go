@@ -2,20 +2,61 @@ package dto
 
 import (
 	"encoding/base64"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldiff"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
 	"time"
 )
 
 // RequestDTO is DTO for request
 type RequestDTO struct {
-	ID           string    `json:"id"`
-	Service      string    `json:"service"`
-	RequestTime  time.Time `json:"request_time"`
-	RequestSize  int64     `json:"request_size"`
-	ResponseTime time.Time `json:"response_time"`
-	ResponseSize int64     `json:"response_size"`
-	Request      string    `json:"request_body,omitempty"`
-	Response     string    `json:"response_body,omitempty"`
+	ID           string       `json:"id"`
+	Service      string       `json:"service"`
+	RuleID       int64        `json:"rule_id"`
+	Server       string       `json:"server"`
+	WeightBucket int          `json:"weight_bucket"`
+	Scenario     string       `json:"scenario,omitempty"`
+	RequestTime  time.Time    `json:"request_time"`
+	RequestSize  int64        `json:"request_size"`
+	ResponseTime time.Time    `json:"response_time"`
+	ResponseSize int64        `json:"response_size"`
+	Request      string       `json:"request_body,omitempty"`
+	Response     string       `json:"response_body,omitempty"`
+	Attempts     []AttemptDTO `json:"attempts,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	Fault        string       `json:"fault,omitempty"`
+	Shadows      []ShadowDTO  `json:"shadows,omitempty"`
+	// PrimaryResponse is server response before rule replacements that shadow responses are compared to
+	PrimaryResponse string `json:"primary_response_body,omitempty"`
+}
+
+// AttemptDTO is DTO for single attempt to send request to server
+type AttemptDTO struct {
+	StartTime  time.Time `json:"start_time"`
+	Duration   string    `json:"duration"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ShadowDTO is DTO for response of shadow server request was mirrored to
+type ShadowDTO struct {
+	Server       string          `json:"server"`
+	Pending      bool            `json:"pending"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	ResponseTime *time.Time      `json:"response_time,omitempty"`
+	Duration     string          `json:"duration,omitempty"`
+	ResponseSize int64           `json:"response_size"`
+	Response     string          `json:"response_body,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Differences  int             `json:"differences"`
+	Diff         []DifferenceDTO `json:"diff,omitempty"`
+}
+
+// DifferenceDTO is DTO for single difference between primary and shadow response
+type DifferenceDTO struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
 }
 
 // RequestsToDTO converts slice of request to DTOs
@@ -32,10 +73,18 @@ func RequestToDTO(req domain.Request) RequestDTO {
 	return RequestDTO{
 		ID:           req.ID,
 		Service:      req.Service,
+		RuleID:       req.RuleID,
+		Server:       req.Server,
+		WeightBucket: req.WeightBucket,
+		Scenario:     req.Scenario,
 		RequestTime:  req.RequestTime,
 		ResponseTime: req.ResponseTime,
 		RequestSize:  req.RequestSize,
 		ResponseSize: req.ResponseSize,
+		Attempts:     attemptsToDTO(req.Attempts),
+		Error:        req.Error,
+		Fault:        req.Fault,
+		Shadows:      shadowsToDTO(req, false),
 	}
 }
 
@@ -43,13 +92,87 @@ func RequestToDTO(req domain.Request) RequestDTO {
 func RequestToFullDTO(req domain.Request) RequestDTO {
 	encoding := base64.StdEncoding
 	return RequestDTO{
-		ID:           req.ID,
-		Service:      req.Service,
-		RequestTime:  req.RequestTime,
-		ResponseTime: req.ResponseTime,
-		RequestSize:  req.RequestSize,
-		ResponseSize: req.ResponseSize,
-		Request:      encoding.EncodeToString(req.Request),
-		Response:     encoding.EncodeToString(req.Response),
+		ID:              req.ID,
+		Service:         req.Service,
+		RuleID:          req.RuleID,
+		Server:          req.Server,
+		WeightBucket:    req.WeightBucket,
+		Scenario:        req.Scenario,
+		RequestTime:     req.RequestTime,
+		ResponseTime:    req.ResponseTime,
+		RequestSize:     req.RequestSize,
+		ResponseSize:    req.ResponseSize,
+		Request:         encoding.EncodeToString(req.Request),
+		Response:        encoding.EncodeToString(req.Response),
+		Attempts:        attemptsToDTO(req.Attempts),
+		Error:           req.Error,
+		Fault:           req.Fault,
+		Shadows:         shadowsToDTO(req, true),
+		PrimaryResponse: primaryResponseToDTO(req.PrimaryResponse),
+	}
+}
+
+func primaryResponseToDTO(response []byte) string {
+	if response == nil {
+		return ""
 	}
+	return base64.StdEncoding.EncodeToString(response)
+}
+
+func attemptsToDTO(attempts []domain.Attempt) []AttemptDTO {
+	if len(attempts) == 0 {
+		return nil
+	}
+	result := make([]AttemptDTO, len(attempts))
+	for i, a := range attempts {
+		result[i] = AttemptDTO{
+			StartTime:  a.StartTime,
+			Duration:   a.Duration.String(),
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+		}
+	}
+	return result
+}
+
+// shadowsToDTO converts shadow responses to DTOs with diff against primary response. Response bodies and diff
+// details are included only when full is set
+func shadowsToDTO(req domain.Request, full bool) []ShadowDTO {
+	shadows := req.Shadows.All()
+	if len(shadows) == 0 {
+		return nil
+	}
+	result := make([]ShadowDTO, len(shadows))
+	for i, s := range shadows {
+		shadow := ShadowDTO{
+			Server:       s.Server,
+			Pending:      !s.Done,
+			StatusCode:   s.StatusCode,
+			ResponseSize: int64(len(s.Response)),
+			Error:        s.Error,
+			Differences:  len(s.Differences),
+		}
+		if s.Done {
+			responseTime := s.ResponseTime
+			shadow.ResponseTime = &responseTime
+			shadow.Duration = s.Duration.String()
+		}
+		if full {
+			shadow.Response = base64.StdEncoding.EncodeToString(s.Response)
+			shadow.Diff = differencesToDTO(s.Differences)
+		}
+		result[i] = shadow
+	}
+	return result
+}
+
+func differencesToDTO(diff []xmldiff.Difference) []DifferenceDTO {
+	if len(diff) == 0 {
+		return nil
+	}
+	result := make([]DifferenceDTO, len(diff))
+	for i, d := range diff {
+		result[i] = DifferenceDTO{Path: d.Path, Kind: d.Kind, Expected: d.Expected, Actual: d.Actual}
+	}
+	return result
 }
@@ -2,29 +2,104 @@ package dto
 
 import (
 	"github.com/aldas/xroad-mock-proxy/pkg/common/dto"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/schedule"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
 	"github.com/pkg/errors"
-	"regexp"
 	"strings"
+	"time"
 )
 
 // RuleDTO is DTO for rule
 type RuleDTO struct {
-	ID                   int64            `json:"id"`
-	Server               string           `json:"server"`
-	Service              string           `json:"service"`
-	Priority             int64            `json:"priority"`
-	MatcherRemoteAddr    []string         `json:"matcher_remote_addr"`
-	MatcherRegex         []string         `json:"matcher_regexes"`
-	RequestReplacements  []ReplacementDTO `json:"request_replacements"`
-	ResponseReplacements []ReplacementDTO `json:"response_replacements"`
-	IsReadOnly           bool             `json:"read_only"`
-}
-
-// ReplacementDTO is DTO for replacements
+	ID                   int64                 `json:"id"`
+	Server               string                `json:"server"`
+	Servers              []WeightedServerDTO   `json:"servers,omitempty"`
+	StickyBy             string                `json:"sticky_by,omitempty"`
+	FallbackServers      []string              `json:"fallback_servers,omitempty"`
+	ShadowServers        []string              `json:"shadow_servers,omitempty"`
+	Service              string                `json:"service"`
+	Priority             int64                 `json:"priority"`
+	MatcherRemoteAddr    []string              `json:"matcher_remote_addr"`
+	MatcherRegex         []string              `json:"matcher_regexes"`
+	MatcherXPath         []string              `json:"matcher_xpaths"`
+	MatcherNamespaces    map[string]string     `json:"matcher_namespaces,omitempty"`
+	MatcherHeader        *dto.HeaderMatcherDTO `json:"matcher_header,omitempty"`
+	Matcher              *dto.MatcherDTO       `json:"matcher,omitempty"`
+	RequestReplacements  []ReplacementDTO      `json:"request_replacements"`
+	ResponseReplacements []ReplacementDTO      `json:"response_replacements"`
+	RequestHeaders       []HeaderOperationDTO  `json:"request_headers,omitempty"`
+	ResponseHeaders      []HeaderOperationDTO  `json:"response_headers,omitempty"`
+	Faults               *FaultsDTO            `json:"faults,omitempty"`
+	Shaping              *ShapingDTO           `json:"shaping,omitempty"`
+	Scenario             string                `json:"scenario,omitempty"`
+	ActiveFrom           string                `json:"active_from,omitempty"`
+	ActiveUntil          string                `json:"active_until,omitempty"`
+	ActiveWindows        []string              `json:"active_windows,omitempty"`
+	MaxMatches           int64                 `json:"max_matches,omitempty"`
+	RemainingMatches     int64                 `json:"remaining_matches,omitempty"`
+	TTL                  string                `json:"ttl,omitempty"`
+	ExpiresAt            *time.Time            `json:"expires_at,omitempty"`
+	IsReadOnly           bool                  `json:"read_only"`
+}
+
+// WeightedServerDTO is DTO for weighted server
+type WeightedServerDTO struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// HeaderOperationDTO is DTO for HTTP header operation
+type HeaderOperationDTO struct {
+	Operation string `json:"operation"`
+	Name      string `json:"name"`
+	Value     string `json:"value,omitempty"`
+}
+
+// FaultsDTO is DTO for faults injected into matched requests
+type FaultsDTO struct {
+	Latency         *LatencyFaultDTO     `json:"latency,omitempty"`
+	ErrorStatus     *ErrorStatusFaultDTO `json:"error_status,omitempty"`
+	ConnectionReset *ProbabilityDTO      `json:"connection_reset,omitempty"`
+	EmptyBody       *ProbabilityDTO      `json:"empty_body,omitempty"`
+	TruncatedBody   *ProbabilityDTO      `json:"truncated_body,omitempty"`
+	SOAPFault       *SOAPFaultDTO        `json:"soap_fault,omitempty"`
+}
+
+// ProbabilityDTO is DTO for fault probability
+type ProbabilityDTO struct {
+	Probability float64 `json:"probability"`
+}
+
+// LatencyFaultDTO is DTO for latency fault
+type LatencyFaultDTO struct {
+	Probability float64 `json:"probability"`
+	Duration    string  `json:"duration"`
+}
+
+// ErrorStatusFaultDTO is DTO for HTTP error status fault
+type ErrorStatusFaultDTO struct {
+	Probability float64 `json:"probability"`
+	Status      int     `json:"status,omitempty"`
+}
+
+// SOAPFaultDTO is DTO for SOAP fault
+type SOAPFaultDTO struct {
+	Probability float64 `json:"probability"`
+	FaultCode   string  `json:"fault_code,omitempty"`
+	FaultString string  `json:"fault_string,omitempty"`
+}
+
+// ReplacementDTO is DTO for replacements. Either regex or xpath rewrite is set
 type ReplacementDTO struct {
-	Regex string `json:"regex"`
-	Value string `json:"value"`
+	Regex     string `json:"regex,omitempty"`
+	Value     string `json:"value"`
+	XPath     string `json:"xpath,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
 }
 
 // RulesToDTO converts slice of rules to DTOs
@@ -41,24 +116,55 @@ func RuleToDTO(r domain.Rule) RuleDTO {
 	return RuleDTO{
 		ID:                   r.ID,
 		Server:               r.Server,
-		Service:              r.Service,
+		Servers:              weightedServersToDTO(r.Servers),
+		StickyBy:             r.StickyBy,
+		FallbackServers:      r.FallbackServers,
+		ShadowServers:        r.ShadowServers,
+		Service:              r.Service.String(),
 		Priority:             r.Priority,
-		MatcherRemoteAddr:    r.MatcherRemoteAddr,
+		MatcherRemoteAddr:    r.MatcherRemoteAddr.Strings(),
 		MatcherRegex:         dto.RegExpToSlice(r.MatcherRegex),
+		MatcherXPath:         dto.XPathToSlice(r.MatcherXPath),
+		MatcherNamespaces:    r.MatcherNamespaces,
+		MatcherHeader:        dto.HeaderMatcherToDTO(r.MatcherHeader),
+		Matcher:              dto.MatcherToDTO(r.Matcher),
 		RequestReplacements:  replacementsToDTO(r.RequestReplacements),
 		ResponseReplacements: replacementsToDTO(r.ResponseReplacements),
+		RequestHeaders:       headerOperationsToDTO(r.RequestHeaders),
+		ResponseHeaders:      headerOperationsToDTO(r.ResponseHeaders),
+		Faults:               faultsToDTO(r.Faults),
+		Shaping:              shapingToDTO(r.Shaping),
+		Scenario:             r.Scenario,
+		ActiveFrom:           schedule.FormatTime(r.Schedule.From),
+		ActiveUntil:          schedule.FormatTime(r.Schedule.Until),
+		ActiveWindows:        r.Schedule.WindowSpecs(),
+		MaxMatches:           r.MaxMatches,
+		RemainingMatches:     r.MatchesLeft,
+		ExpiresAt:            expiresAtToDTO(r.ExpiresAt),
 		IsReadOnly:           r.IsReadOnly,
 	}
 }
 
 // ToRule converts DTO object to rule domain object
 func ToRule(r RuleDTO) (domain.Rule, error) {
-	if r.Server == "" {
-		return domain.Rule{}, errors.New("server can not be empty")
+	servers := toWeightedServers(r.Servers)
+	if err := domain.ValidateServers(r.Server, servers, r.StickyBy); err != nil {
+		return domain.Rule{}, err
 	}
 
-	if r.Service == "" && len(r.MatcherRemoteAddr) == 0 && len(r.MatcherRegex) == 0 {
-		return domain.Rule{}, errors.New("at least one matcher must be set")
+	headerMatcher := dto.ToHeaderMatcher(r.MatcherHeader)
+	expression, err := dto.ToMatcher(r.Matcher, r.MatcherNamespaces)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+	service, err := soap.ParseRuleService(r.Service)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	remoteAddrMatcher, err := remoteaddr.Parse(r.MatcherRemoteAddr)
+	if err != nil {
+		return domain.Rule{}, err
 	}
 
 	matchers, err := dto.SliceToRegexp(r.MatcherRegex)
@@ -66,6 +172,26 @@ func ToRule(r RuleDTO) (domain.Rule, error) {
 		return domain.Rule{}, err
 	}
 
+	xpathMatchers, err := dto.SliceToXPath(r.MatcherXPath, r.MatcherNamespaces)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	activeSchedule, err := schedule.Parse(r.ActiveFrom, r.ActiveUntil, r.ActiveWindows)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	var expiresAt time.Time
+	if r.ExpiresAt != nil {
+		expiresAt = *r.ExpiresAt
+	}
+	// rule returned by API (GET) and sent back (PUT) keeps its remaining matches and expiry time
+	limit, err := usage.Restore(r.MaxMatches, r.RemainingMatches, expiresAt, r.TTL)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
 	requestReplacements, err := toReplacements(r.RequestReplacements)
 	if err != nil {
 		return domain.Rule{}, err
@@ -76,19 +202,167 @@ func ToRule(r RuleDTO) (domain.Rule, error) {
 		return domain.Rule{}, err
 	}
 
+	requestHeaders, err := toHeaderOperations(r.RequestHeaders)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	responseHeaders, err := toHeaderOperations(r.ResponseHeaders)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	faults, err := toFaults(r.Faults)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
+	shaping, err := toShaping(r.Shaping)
+	if err != nil {
+		return domain.Rule{}, err
+	}
+
 	return domain.Rule{
 		ID:                   r.ID,
 		Server:               strings.ToLower(r.Server),
-		Service:              r.Service,
+		Servers:              servers,
+		StickyBy:             r.StickyBy,
+		FallbackServers:      domain.NormalizeServerNames(r.FallbackServers),
+		ShadowServers:        domain.NormalizeServerNames(r.ShadowServers),
+		Service:              service,
 		Priority:             r.Priority,
-		MatcherRemoteAddr:    r.MatcherRemoteAddr,
+		MatcherRemoteAddr:    remoteAddrMatcher,
 		MatcherRegex:         matchers,
+		MatcherXPath:         xpathMatchers,
+		MatcherNamespaces:    r.MatcherNamespaces,
+		MatcherHeader:        headerMatcher,
+		Matcher:              expression,
 		RequestReplacements:  requestReplacements,
 		ResponseReplacements: responseReplacements,
+		RequestHeaders:       requestHeaders,
+		ResponseHeaders:      responseHeaders,
+		Faults:               faults,
+		Shaping:              shaping,
+		Schedule:             activeSchedule,
+		Scenario:             r.Scenario,
+		Limit:                limit,
 		IsReadOnly:           r.IsReadOnly,
 	}, nil
 }
 
+func expiresAtToDTO(expiresAt time.Time) *time.Time {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return &expiresAt
+}
+
+func weightedServersToDTO(servers domain.WeightedServers) []WeightedServerDTO {
+	if len(servers) == 0 {
+		return nil
+	}
+	result := make([]WeightedServerDTO, len(servers))
+	for i, s := range servers {
+		result[i] = WeightedServerDTO{Name: s.Name, Weight: s.Weight}
+	}
+	return result
+}
+
+func toWeightedServers(servers []WeightedServerDTO) domain.WeightedServers {
+	result := make(domain.WeightedServers, len(servers))
+	for i, s := range servers {
+		result[i] = domain.WeightedServer{Name: strings.ToLower(s.Name), Weight: s.Weight}
+	}
+	return result
+}
+
+func headerOperationsToDTO(operations domain.HeaderOperations) []HeaderOperationDTO {
+	if len(operations) == 0 {
+		return nil
+	}
+	result := make([]HeaderOperationDTO, len(operations))
+	for i, o := range operations {
+		result[i] = HeaderOperationDTO{Operation: o.Operation, Name: o.Name, Value: o.Value.String()}
+	}
+	return result
+}
+
+func toHeaderOperations(operations []HeaderOperationDTO) (domain.HeaderOperations, error) {
+	result := make(domain.HeaderOperations, len(operations))
+	for i, o := range operations {
+		operation, err := domain.NewHeaderOperation(o.Operation, o.Name, o.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = operation
+	}
+	return result, nil
+}
+
+func faultsToDTO(f domain.Faults) *FaultsDTO {
+	if f.IsEmpty() {
+		return nil
+	}
+	result := &FaultsDTO{}
+	if f.Latency.Probability > 0 {
+		result.Latency = &LatencyFaultDTO{Probability: f.Latency.Probability, Duration: f.Latency.Duration.String()}
+	}
+	if f.ErrorStatus.Probability > 0 {
+		result.ErrorStatus = &ErrorStatusFaultDTO{Probability: f.ErrorStatus.Probability, Status: f.ErrorStatus.Status}
+	}
+	if f.ConnectionReset > 0 {
+		result.ConnectionReset = &ProbabilityDTO{Probability: f.ConnectionReset}
+	}
+	if f.EmptyBody > 0 {
+		result.EmptyBody = &ProbabilityDTO{Probability: f.EmptyBody}
+	}
+	if f.TruncatedBody > 0 {
+		result.TruncatedBody = &ProbabilityDTO{Probability: f.TruncatedBody}
+	}
+	if f.SOAPFault.Probability > 0 {
+		result.SOAPFault = &SOAPFaultDTO{
+			Probability: f.SOAPFault.Probability,
+			FaultCode:   f.SOAPFault.FaultCode,
+			FaultString: f.SOAPFault.FaultString,
+		}
+	}
+	return result
+}
+
+func toFaults(f *FaultsDTO) (domain.Faults, error) {
+	if f == nil {
+		return domain.Faults{}, nil
+	}
+	conf := config.FaultsConf{}
+	if f.Latency != nil {
+		duration, err := time.ParseDuration(f.Latency.Duration)
+		if err != nil {
+			return domain.Faults{}, errors.Wrap(err, "failed to parse latency fault duration")
+		}
+		conf.Latency = config.LatencyFaultConf{Probability: f.Latency.Probability, Duration: duration}
+	}
+	if f.ErrorStatus != nil {
+		conf.ErrorStatus = config.ErrorStatusFaultConf{Probability: f.ErrorStatus.Probability, Status: f.ErrorStatus.Status}
+	}
+	if f.ConnectionReset != nil {
+		conf.ConnectionReset = config.ProbabilityConf{Probability: f.ConnectionReset.Probability}
+	}
+	if f.EmptyBody != nil {
+		conf.EmptyBody = config.ProbabilityConf{Probability: f.EmptyBody.Probability}
+	}
+	if f.TruncatedBody != nil {
+		conf.TruncatedBody = config.ProbabilityConf{Probability: f.TruncatedBody.Probability}
+	}
+	if f.SOAPFault != nil {
+		conf.SOAPFault = config.SOAPFaultConf{
+			Probability: f.SOAPFault.Probability,
+			FaultCode:   f.SOAPFault.FaultCode,
+			FaultString: f.SOAPFault.FaultString,
+		}
+	}
+	return domain.ConvertFaults(conf)
+}
+
 func replacementsToDTO(replacements domain.Replacements) []ReplacementDTO {
 	result := make([]ReplacementDTO, len(replacements))
 	for i := 0; i < len(replacements); i++ {
@@ -98,9 +372,17 @@ func replacementsToDTO(replacements domain.Replacements) []ReplacementDTO {
 }
 
 func replacementToDTO(r domain.Replacement) ReplacementDTO {
+	if r.Rewrite != nil {
+		return ReplacementDTO{
+			Value:     r.Value.String(),
+			XPath:     r.Rewrite.Expression.String(),
+			Operation: r.Rewrite.Operation,
+			Prefix:    r.Rewrite.Prefix,
+		}
+	}
 	return ReplacementDTO{
 		Regex: r.Regex.String(),
-		Value: r.Value,
+		Value: r.Value.String(),
 	}
 }
 
@@ -117,13 +399,5 @@ func toReplacements(replacements []ReplacementDTO) ([]domain.Replacement, error)
 }
 
 func toReplacement(r ReplacementDTO) (domain.Replacement, error) {
-	regex, err := regexp.Compile(r.Regex)
-	if err != nil {
-		return domain.Replacement{}, errors.Wrap(err, "failed to compile replacement regexp")
-	}
-
-	return domain.Replacement{
-		Regex: regex,
-		Value: r.Value,
-	}, nil
+	return domain.NewReplacement(r.Regex, r.Value, r.XPath, r.Operation, r.Prefix)
 }
@@ -1,20 +1,112 @@
 package dto
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/server"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
 	"github.com/pkg/errors"
-	"net/url"
 	"strings"
+	"time"
 )
 
-// ServerDTO is DTO for proxyServer
+// ServerDTO is DTO for proxyServer. Health checks are started only for servers from configuration file so
+// sending `health_check` through API is an error
 type ServerDTO struct {
-	ID         int64   `json:"id"`
-	Name       string  `json:"name"`
-	Address    string  `json:"address"`
-	IsReadOnly bool    `json:"read_only"`
-	TLS        *TLSDTO `json:"tls,omitempty"`
+	ID              int64             `json:"id"`
+	Name            string            `json:"name"`
+	Address         string            `json:"address"`
+	IsReadOnly      bool              `json:"read_only"`
+	TLS             *TLSDTO           `json:"tls,omitempty"`
+	Transport       *TransportDTO     `json:"transport,omitempty"`
+	OutboundProxy   *OutboundProxyDTO `json:"outbound_proxy,omitempty"`
+	Endpoints       []EndpointDTO     `json:"endpoints,omitempty"`
+	LoadBalancing   string            `json:"load_balancing,omitempty"`
+	FallbackServers []string          `json:"fallback_servers,omitempty"`
+	Health          *HealthDTO        `json:"health,omitempty"`
+	Retry           *RetryDTO         `json:"retry,omitempty"`
+	CircuitBreaker  *CircuitDTO       `json:"circuit_breaker,omitempty"`
+	Shaping         *ShapingDTO       `json:"shaping,omitempty"`
+	Translations    []TranslationDTO  `json:"translations,omitempty"`
+	HealthCheck     *json.RawMessage  `json:"health_check,omitempty"`
+}
+
+// TranslationDTO is DTO for X-road identifier prefix translation (for example 'ee-test/GOV' to 'ee-dev/GOV')
+type TranslationDTO struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ShapingDTO is DTO for latency (durations like '200ms') and bandwidth limits of proxied traffic
+type ShapingDTO struct {
+	Latency                string `json:"latency,omitempty"`
+	Jitter                 string `json:"jitter,omitempty"`
+	RequestBytesPerSecond  int64  `json:"request_bytes_per_second,omitempty"`
+	ResponseBytesPerSecond int64  `json:"response_bytes_per_second,omitempty"`
+}
+
+// OutboundProxyDTO is DTO for outbound proxy of server. Password is never returned
+type OutboundProxyDTO struct {
+	URL      string   `json:"url"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	NoProxy  []string `json:"no_proxy,omitempty"`
+}
+
+// EndpointDTO is DTO for server endpoint and its health
+type EndpointDTO struct {
+	Address        string     `json:"address"`
+	ActiveRequests int64      `json:"active_requests"`
+	Healthy        bool       `json:"healthy"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// RetryDTO is DTO for server retry policy (durations like '100ms')
+type RetryDTO struct {
+	MaxAttempts       int      `json:"max_attempts"`
+	Backoff           string   `json:"backoff,omitempty"`
+	MaxBackoff        string   `json:"max_backoff,omitempty"`
+	BackoffMultiplier float64  `json:"backoff_multiplier,omitempty"`
+	RetryOnStatus     []int    `json:"retry_on_status,omitempty"`
+	RetryOnErrors     []string `json:"retry_on_errors,omitempty"`
+}
+
+// CircuitDTO is DTO for server circuit breaker settings (durations like '30s') and state. State fields are ignored
+// when server is saved
+type CircuitDTO struct {
+	FailureThreshold int        `json:"failure_threshold"`
+	SuccessThreshold int        `json:"success_threshold,omitempty"`
+	OpenTimeout      string     `json:"open_timeout,omitempty"`
+	HalfOpenRequests int        `json:"half_open_requests,omitempty"`
+	FailureStatus    []int      `json:"failure_status,omitempty"`
+	State            string     `json:"state,omitempty"`
+	Failures         int        `json:"failures"`
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`
+}
+
+// TransportDTO is DTO for server transport timeouts (durations like '90s') and connection pool settings
+type TransportDTO struct {
+	DialTimeout           string `json:"dial_timeout,omitempty"`
+	KeepAlive             string `json:"keep_alive,omitempty"`
+	TLSHandshakeTimeout   string `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty"`
+	Timeout               string `json:"timeout,omitempty"`
+	IdleConnTimeout       string `json:"idle_conn_timeout,omitempty"`
+	MaxIdleConns          int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int    `json:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost       int    `json:"max_conns_per_host,omitempty"`
+	DisableKeepAlives     bool   `json:"disable_keep_alives"`
+	ForceHTTP2            bool   `json:"force_http2"`
+}
+
+// HealthDTO is DTO for server health state
+type HealthDTO struct {
+	Healthy   bool       `json:"healthy"`
+	CheckType string     `json:"check_type,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
 }
 
 // TLSDTO is DTO for server TLS configuration
@@ -38,34 +130,356 @@ func ProxyServersToDTO(rules []domain.ProxyServer) []ServerDTO {
 // ProxyServerToDTO converts proxy server to DTO
 func ProxyServerToDTO(s domain.ProxyServer) ServerDTO {
 	return ServerDTO{
-		ID:         s.ID,
-		Name:       s.Name,
-		Address:    s.Address.String(),
-		IsReadOnly: s.IsReadOnly,
+		ID:              s.ID,
+		Name:            s.Name,
+		Address:         s.Address.String(),
+		IsReadOnly:      s.IsReadOnly,
+		Transport:       transportToDTO(s.TransportSettings),
+		OutboundProxy:   outboundProxyToDTO(s.TransportSettings.Proxy),
+		Endpoints:       endpointsToDTO(s.Endpoints),
+		LoadBalancing:   loadBalancingToDTO(s.Endpoints),
+		FallbackServers: s.FallbackServers,
+		Health:          healthToDTO(s),
+		Retry:           retryToDTO(s.Retry),
+		CircuitBreaker:  circuitToDTO(s.Breaker),
+		Shaping:         shapingToDTO(s.Shaping),
+		Translations:    translationsToDTO(s.Translations),
+	}
+}
+
+func circuitToDTO(b *domain.CircuitBreaker) *CircuitDTO {
+	if b == nil {
+		return nil
+	}
+	status := b.Status()
+	result := CircuitDTO{
+		FailureThreshold: b.Settings.FailureThreshold,
+		SuccessThreshold: b.Settings.SuccessThreshold,
+		OpenTimeout:      durationToDTO(b.Settings.OpenTimeout),
+		HalfOpenRequests: b.Settings.HalfOpenRequests,
+		FailureStatus:    b.Settings.FailureStatus,
+		State:            string(status.State),
+		Failures:         status.Failures,
+	}
+	if !status.OpenedAt.IsZero() {
+		result.OpenedAt = &status.OpenedAt
+	}
+	return &result
+}
+
+func healthToDTO(s domain.ProxyServer) *HealthDTO {
+	result := HealthDTO{
+		Healthy:   s.IsHealthy(),
+		CheckType: s.HealthCheck.Type,
+	}
+	if s.Endpoints != nil && len(s.Endpoints.Endpoints) == 1 {
+		status := s.Endpoints.Endpoints[0].Health.Status()
+		result.Error = status.Error
+		if !status.CheckedAt.IsZero() {
+			result.CheckedAt = &status.CheckedAt
+		}
+	}
+	return &result
+}
+
+func endpointsToDTO(pool *domain.EndpointPool) []EndpointDTO {
+	if pool == nil {
+		return nil
+	}
+	result := make([]EndpointDTO, len(pool.Endpoints))
+	for i, e := range pool.Endpoints {
+		status := e.Health.Status()
+		result[i] = EndpointDTO{
+			Address:        e.Address.String(),
+			ActiveRequests: e.ActiveRequests(),
+			Healthy:        status.Healthy,
+			Error:          status.Error,
+		}
+		if !status.CheckedAt.IsZero() {
+			result[i].CheckedAt = &status.CheckedAt
+		}
 	}
+	return result
+}
+
+func loadBalancingToDTO(pool *domain.EndpointPool) string {
+	if pool == nil {
+		return ""
+	}
+	return pool.Strategy
 }
 
 // ToProxyServer converts DTO object to proxyServer domain object
 func ToProxyServer(s ServerDTO) (domain.ProxyServer, error) {
-	address, err := url.Parse(s.Address)
+	if s.HealthCheck != nil {
+		// health checks are started only for servers from configuration file
+		return domain.ProxyServer{}, errors.New("health_check can not be set through API, configure it in configuration file")
+	}
+
+	address := s.Address
+	endpointAddresses := make([]string, len(s.Endpoints))
+	for i, e := range s.Endpoints {
+		endpointAddresses[i] = e.Address
+	}
+	if len(endpointAddresses) > 0 {
+		// address of server is first of its endpoints
+		address = ""
+	}
+	addresses, err := domain.ParseAddresses(address, endpointAddresses)
 	if err != nil {
-		return domain.ProxyServer{}, errors.Wrap(err, "failed to parse address to url")
+		return domain.ProxyServer{}, err
+	}
+	endpoints, err := domain.NewEndpointPool(s.LoadBalancing, addresses)
+	if err != nil {
+		return domain.ProxyServer{}, err
 	}
 
-	caCertBytes := []byte(s.TLS.CACert)
-	certBytes := []byte(s.TLS.Cert)
-	keyBytes := []byte(s.TLS.Key)
-	tls, err := server.ToTLSConfig(caCertBytes, certBytes, keyBytes, s.TLS.KeyPassword)
+	var tls *tls.Config
+	if s.TLS != nil && !s.TLS.UseSystemTransport {
+		caCertBytes := []byte(s.TLS.CACert)
+		certBytes := []byte(s.TLS.Cert)
+		keyBytes := []byte(s.TLS.Key)
+		tls, err = server.ToTLSConfig(caCertBytes, certBytes, keyBytes, s.TLS.KeyPassword)
+		if err != nil {
+			return domain.ProxyServer{}, err
+		}
+	}
+
+	settings, err := toTransportSettings(s.Transport)
+	if err != nil {
+		return domain.ProxyServer{}, err
+	}
+	if s.OutboundProxy != nil {
+		p := s.OutboundProxy
+		settings.Proxy, err = domain.NewOutboundProxy(p.URL, p.Username, p.Password, p.NoProxy)
+		if err != nil {
+			return domain.ProxyServer{}, err
+		}
+	}
+
+	retry, err := toRetryPolicy(s.Retry)
+	if err != nil {
+		return domain.ProxyServer{}, err
+	}
+
+	breaker, err := toCircuitBreaker(s.CircuitBreaker)
+	if err != nil {
+		return domain.ProxyServer{}, err
+	}
+
+	shaping, err := toShaping(s.Shaping)
+	if err != nil {
+		return domain.ProxyServer{}, err
+	}
+
+	translations, err := toTranslations(s.Translations)
 	if err != nil {
 		return domain.ProxyServer{}, err
 	}
 
 	return domain.ProxyServer{
-		ID:         0,
-		Name:       strings.ToLower(s.Name),
-		Address:    *address,
-		IsDefault:  false,
-		IsReadOnly: s.IsReadOnly,
-		Transport:  domain.ProxyServerTransport(tls),
+		ID:                0,
+		Name:              strings.ToLower(s.Name),
+		Address:           addresses[0],
+		IsDefault:         false,
+		IsReadOnly:        s.IsReadOnly,
+		Transport:         domain.ProxyServerTransport(tls, settings),
+		TransportSettings: settings,
+		Endpoints:         endpoints,
+		FallbackServers:   domain.NormalizeServerNames(s.FallbackServers),
+		Retry:             retry,
+		Breaker:           breaker,
+		Shaping:           shaping,
+		Translations:      translations,
 	}, nil
 }
+
+func transportToDTO(s domain.TransportSettings) *TransportDTO {
+	return &TransportDTO{
+		DialTimeout:           durationToDTO(s.DialTimeout),
+		KeepAlive:             durationToDTO(s.KeepAlive),
+		TLSHandshakeTimeout:   durationToDTO(s.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: durationToDTO(s.ResponseHeaderTimeout),
+		Timeout:               durationToDTO(s.Timeout),
+		IdleConnTimeout:       durationToDTO(s.IdleConnTimeout),
+		MaxIdleConns:          s.MaxIdleConns,
+		MaxIdleConnsPerHost:   s.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       s.MaxConnsPerHost,
+		DisableKeepAlives:     s.DisableKeepAlives,
+		ForceHTTP2:            s.ForceHTTP2,
+	}
+}
+
+func toTransportSettings(t *TransportDTO) (domain.TransportSettings, error) {
+	if t == nil {
+		return domain.DefaultTransportSettings(), nil
+	}
+
+	conf := config.TransportConf{
+		MaxIdleConns:        t.MaxIdleConns,
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     t.MaxConnsPerHost,
+		DisableKeepAlives:   t.DisableKeepAlives,
+		ForceHTTP2:          t.ForceHTTP2,
+	}
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{t.DialTimeout, &conf.DialTimeout},
+		{t.KeepAlive, &conf.KeepAlive},
+		{t.TLSHandshakeTimeout, &conf.TLSHandshakeTimeout},
+		{t.ResponseHeaderTimeout, &conf.ResponseHeaderTimeout},
+		{t.Timeout, &conf.Timeout},
+		{t.IdleConnTimeout, &conf.IdleConnTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return domain.TransportSettings{}, errors.Wrapf(err, "failed to parse transport duration '%v'", d.value)
+		}
+		*d.target = duration
+	}
+	return domain.ConvertTransportSettings(conf)
+}
+
+func retryToDTO(p domain.RetryPolicy) *RetryDTO {
+	return &RetryDTO{
+		MaxAttempts:       p.MaxAttempts,
+		Backoff:           durationToDTO(p.Backoff),
+		MaxBackoff:        durationToDTO(p.MaxBackoff),
+		BackoffMultiplier: p.Multiplier,
+		RetryOnStatus:     p.RetryOnStatus,
+		RetryOnErrors:     p.RetryOnErrors,
+	}
+}
+
+func toRetryPolicy(r *RetryDTO) (domain.RetryPolicy, error) {
+	if r == nil {
+		return domain.ConvertRetryPolicy(config.RetryConf{})
+	}
+	conf := config.RetryConf{
+		MaxAttempts:       r.MaxAttempts,
+		BackoffMultiplier: r.BackoffMultiplier,
+		RetryOnStatus:     r.RetryOnStatus,
+		RetryOnErrors:     r.RetryOnErrors,
+	}
+	for _, d := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{r.Backoff, &conf.Backoff},
+		{r.MaxBackoff, &conf.MaxBackoff},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return domain.RetryPolicy{}, errors.Wrapf(err, "failed to parse retry duration '%v'", d.value)
+		}
+		*d.target = duration
+	}
+	return domain.ConvertRetryPolicy(conf)
+}
+
+func toCircuitBreaker(c *CircuitDTO) (*domain.CircuitBreaker, error) {
+	if c == nil {
+		return nil, nil
+	}
+	conf := config.CircuitBreakerConf{
+		FailureThreshold: c.FailureThreshold,
+		SuccessThreshold: c.SuccessThreshold,
+		HalfOpenRequests: c.HalfOpenRequests,
+		FailureStatus:    c.FailureStatus,
+	}
+	if c.OpenTimeout != "" {
+		duration, err := time.ParseDuration(c.OpenTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse circuit breaker duration '%v'", c.OpenTimeout)
+		}
+		conf.OpenTimeout = duration
+	}
+	return domain.ConvertCircuitBreaker(conf)
+}
+
+func outboundProxyToDTO(p domain.OutboundProxy) *OutboundProxyDTO {
+	if p.IsEmpty() {
+		return nil
+	}
+	proxyURL := *p.URL
+	proxyURL.User = nil
+	return &OutboundProxyDTO{
+		URL:      proxyURL.String(),
+		Username: p.URL.User.Username(),
+		NoProxy:  p.NoProxy,
+	}
+}
+
+func shapingToDTO(s domain.Shaping) *ShapingDTO {
+	if s.IsEmpty() {
+		return nil
+	}
+	return &ShapingDTO{
+		Latency:                durationToDTO(s.Latency),
+		Jitter:                 durationToDTO(s.Jitter),
+		RequestBytesPerSecond:  s.RequestBytesPerSecond,
+		ResponseBytesPerSecond: s.ResponseBytesPerSecond,
+	}
+}
+
+func toShaping(s *ShapingDTO) (domain.Shaping, error) {
+	if s == nil {
+		return domain.Shaping{}, nil
+	}
+	conf := config.ShapingConf{
+		RequestBytesPerSecond:  s.RequestBytesPerSecond,
+		ResponseBytesPerSecond: s.ResponseBytesPerSecond,
+	}
+	for _, d := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{s.Latency, &conf.Latency},
+		{s.Jitter, &conf.Jitter},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return domain.Shaping{}, errors.Wrapf(err, "failed to parse shaping duration '%v'", d.value)
+		}
+		*d.target = duration
+	}
+	return domain.ConvertShaping(conf)
+}
+
+func translationsToDTO(translations domain.Translations) []TranslationDTO {
+	if len(translations) == 0 {
+		return nil
+	}
+	result := make([]TranslationDTO, len(translations))
+	for i, t := range translations {
+		result[i] = TranslationDTO{From: strings.Join(t.From, "/"), To: strings.Join(t.To, "/")}
+	}
+	return result
+}
+
+func toTranslations(translations []TranslationDTO) (domain.Translations, error) {
+	conf := make(config.TranslationConfigs, len(translations))
+	for i, t := range translations {
+		conf[i] = config.TranslationConf{From: t.From, To: t.To}
+	}
+	return domain.ConvertTranslations(conf)
+}
+
+func durationToDTO(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,92 @@
+package dto
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestToProxyServerHealthCheckNotSupported(t *testing.T) {
+	var s ServerDTO
+	err := json.Unmarshal([]byte(`{"name":"test","address":"http://localhost:8080","health_check":{"type":"tcp"}}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ToProxyServer(s)
+	assert.EqualError(t, err, "health_check can not be set through API, configure it in configuration file")
+}
+
+func TestToProxyServerUseSystemTransport(t *testing.T) {
+	s, err := ToProxyServer(ServerDTO{
+		Name:    "test",
+		Address: "https://localhost:8443",
+		TLS:     &TLSDTO{UseSystemTransport: true, Cert: "not a certificate"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, ok := s.Transport.(*http.Transport)
+	if assert.True(t, ok) {
+		assert.Nil(t, transport.TLSClientConfig)
+	}
+}
+
+func TestToProxyServerRetry(t *testing.T) {
+	s, err := ToProxyServer(ServerDTO{
+		Name:    "test",
+		Address: "http://localhost:8080",
+		Retry:   &RetryDTO{MaxAttempts: 3, Backoff: "50ms", RetryOnStatus: []int{503}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, s.Retry.MaxAttempts)
+	assert.Equal(t, 50*time.Millisecond, s.Retry.Backoff)
+	assert.Equal(t, &RetryDTO{
+		MaxAttempts:       3,
+		Backoff:           "50ms",
+		MaxBackoff:        "5s",
+		BackoffMultiplier: 2,
+		RetryOnStatus:     []int{503},
+		RetryOnErrors:     []string{"connect", "reset", "timeout"},
+	}, ProxyServerToDTO(s).Retry)
+
+	_, err = ToProxyServer(ServerDTO{Name: "test", Address: "http://localhost:8080", Retry: &RetryDTO{Backoff: "x"}})
+	assert.EqualError(t, err, "failed to parse retry duration 'x': time: invalid duration \"x\"")
+}
+
+func TestToProxyServerCircuitBreaker(t *testing.T) {
+	s, err := ToProxyServer(ServerDTO{
+		Name:           "test",
+		Address:        "http://localhost:8080",
+		CircuitBreaker: &CircuitDTO{FailureThreshold: 5, OpenTimeout: "1m", State: "open", Failures: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.NotNil(t, s.Breaker) {
+		return
+	}
+	assert.Equal(t, &CircuitDTO{
+		FailureThreshold: 5,
+		SuccessThreshold: 1,
+		OpenTimeout:      "1m0s",
+		HalfOpenRequests: 1,
+		FailureStatus:    []int{502, 503, 504},
+		State:            "closed",
+		Failures:         0,
+	}, ProxyServerToDTO(s).CircuitBreaker)
+
+	s, err = ToProxyServer(ServerDTO{Name: "test", Address: "http://localhost:8080"})
+	assert.NoError(t, err)
+	assert.Nil(t, s.Breaker)
+
+	_, err = ToProxyServer(ServerDTO{Name: "test", Address: "http://localhost:8080", CircuitBreaker: &CircuitDTO{FailureThreshold: -1}})
+	assert.EqualError(t, err, "circuit_breaker thresholds, open_timeout and half_open_requests can not be negative")
+}
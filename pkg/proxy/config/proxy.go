@@ -22,6 +22,9 @@ type ServerConf struct {
 	ReadTimeoutSeconds  int                  `mapstructure:"read_timeout_seconds"`
 	WriteTimeoutSeconds int                  `mapstructure:"write_timeout_seconds"`
 	Debug               bool                 `mapstructure:"is_debug"`
+	// list of proxy addresses (IP or CIDR range) in front of this server that are trusted to set X-Forwarded-For
+	// and Forwarded headers. Client address is resolved from these headers when request comes from trusted proxy.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // APIConf describes API server configuration that application starts
@@ -54,6 +57,142 @@ type ProxyServerConf struct {
 	IsDefault bool           `mapstructure:"is_default"`
 	// should rule be changeable in API (defaults to true)
 	IsReadOnly *bool `mapstructure:"read_only"`
+	// (optional) list of endpoint addresses of same logical server. Alternative to `address`
+	Endpoints []string `mapstructure:"endpoints"`
+	// (optional) how requests are balanced between endpoints: `round_robin` (default), `least_conn` or `random`
+	LoadBalancing string `mapstructure:"load_balancing"`
+	// (optional) timeouts and connection pool settings of transport used to send requests to server
+	Transport TransportConf `mapstructure:"transport"`
+	// (optional) outbound HTTP/HTTPS proxy requests to server are sent through. HTTPS requests (including client
+	// certificate TLS) are tunnelled with CONNECT. Server is connected directly when omitted
+	OutboundProxy OutboundProxyConf `mapstructure:"outbound_proxy"`
+	// (optional) periodic health check of server. Server is always considered healthy when omitted
+	HealthCheck HealthCheckConf `mapstructure:"health_check"`
+	// (optional) names of servers where requests are sent instead when this server is unhealthy. First healthy wins
+	FallbackServers []string `mapstructure:"fallback_servers"`
+	// (optional) how failed requests to server are retried. Requests are sent once when omitted
+	Retry RetryConf `mapstructure:"retry"`
+	// (optional) circuit breaker that fails requests fast with SOAP fault while server keeps failing
+	CircuitBreaker CircuitBreakerConf `mapstructure:"circuit_breaker"`
+	// (optional) latency and bandwidth limits simulating slow network link to server
+	Shaping ShapingConf `mapstructure:"shaping"`
+	// (optional) X-road identifier translations between environments. Client and service identifiers in request
+	// header are translated on the way to server and translated back in response header
+	Translations TranslationConfigs `mapstructure:"translations"`
+}
+
+// TranslationConfigs is collection type for TranslationConf structure
+type TranslationConfigs []TranslationConf
+
+// TranslationConf describes X-road identifier prefix `instance[/memberClass[/memberCode[/subsystemCode]]]` that is
+// replaced with another prefix of same length. For example `ee-test` to `ee-dev` or `ee-test/GOV/70000310` to
+// `ee-dev/GOV/70000311`
+type TranslationConf struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+// ShapingConf describes latency and bandwidth limits of proxied traffic. Rule settings override settings of server
+type ShapingConf struct {
+	// (optional) delay added before request is sent to server (for example: 200ms)
+	Latency time.Duration `mapstructure:"latency"`
+	// (optional) random extra delay up to this duration added to latency (for example: 100ms)
+	Jitter time.Duration `mapstructure:"jitter"`
+	// (optional) maximum speed in bytes per second request body is streamed to server
+	RequestBytesPerSecond int64 `mapstructure:"request_bytes_per_second"`
+	// (optional) maximum speed in bytes per second response body is streamed to client
+	ResponseBytesPerSecond int64 `mapstructure:"response_bytes_per_second"`
+}
+
+// CircuitBreakerConf describes when circuit breaker of server opens and closes
+type CircuitBreakerConf struct {
+	// consecutive failed requests after which circuit opens. Circuit breaker is disabled when omitted
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// (optional) successful trial requests in half-open state needed to close circuit (default 1)
+	SuccessThreshold int `mapstructure:"success_threshold"`
+	// (optional) how long circuit stays open before trial requests are let through (default 30s)
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+	// (optional) number of concurrent trial requests in half-open state (default 1)
+	HalfOpenRequests int `mapstructure:"half_open_requests"`
+	// (optional) response status codes counted as failures in addition to connection errors (default 502, 503, 504)
+	FailureStatus []int `mapstructure:"failure_status"`
+}
+
+// RetryConf describes retry policy for requests to server
+type RetryConf struct {
+	// maximum number of attempts including first one (default 1 - no retries)
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// (optional) wait before first retry (default 100ms)
+	Backoff time.Duration `mapstructure:"backoff"`
+	// (optional) maximum wait between retries (default 5s)
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// (optional) multiplier of wait for each subsequent retry (default 2)
+	BackoffMultiplier float64 `mapstructure:"backoff_multiplier"`
+	// (optional) response status codes that are retried (for example: 502, 503, 504)
+	RetryOnStatus []int `mapstructure:"retry_on_status"`
+	// (optional) errors that are retried: `connect` (connection failed), `reset` (connection closed/reset by server)
+	// and `timeout`. All of them are retried when omitted
+	RetryOnErrors []string `mapstructure:"retry_on_errors"`
+}
+
+// TransportConf describes timeouts and connection pool of transport used to send requests to server
+type TransportConf struct {
+	// (optional) timeout for establishing TCP connection (default 30s)
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// (optional) interval of TCP keep-alive probes (default 30s)
+	KeepAlive time.Duration `mapstructure:"keep_alive"`
+	// (optional) timeout for TLS handshake (default 10s)
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout"`
+	// (optional) time to wait for response headers after request is sent. No limit when omitted
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// (optional) overall time limit for request including reading response body. No limit when omitted
+	Timeout time.Duration `mapstructure:"timeout"`
+	// (optional) how long idle connection is kept in pool (default 90s)
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// (optional) maximum number of idle connections in pool (default 100)
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// (optional) maximum number of idle connections per host in pool (default 2)
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// (optional) maximum number of connections per host (default 25)
+	MaxConnsPerHost int `mapstructure:"max_conns_per_host"`
+	// (optional) use new connection for each request
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"`
+	// (optional) prefer HTTP/2 when server supports it
+	ForceHTTP2 bool `mapstructure:"force_http2"`
+}
+
+// OutboundProxyConf describes outbound proxy for requests to server
+type OutboundProxyConf struct {
+	// proxy url (for example: http://proxy.example.com:3128)
+	URL string `mapstructure:"url"`
+	// (optional) username for proxy basic authentication
+	Username string `mapstructure:"username"`
+	// (optional) password for proxy basic authentication
+	Password string `mapstructure:"password"`
+	// (optional) hosts, domains (.example.com), IP addresses or CIDR ranges that are connected to directly
+	NoProxy []string `mapstructure:"no_proxy"`
+}
+
+// HealthCheckConf describes how server health is checked
+type HealthCheckConf struct {
+	// type of check: `http` (GET request), `tcp` (connect) or `soap` (X-road metaservice request, listMethods by default)
+	Type string `mapstructure:"type"`
+	// (optional) path for `http` and `soap` checks. Defaults to server address path
+	Path string `mapstructure:"path"`
+	// (optional) how often health is checked (default 10s)
+	Interval time.Duration `mapstructure:"interval"`
+	// (optional) timeout for single check (default 5s)
+	Timeout time.Duration `mapstructure:"timeout"`
+	// (optional) consecutive successful checks needed to mark unhealthy server healthy (default 1)
+	HealthyThreshold int `mapstructure:"healthy_threshold"`
+	// (optional) consecutive failed checks needed to mark healthy server unhealthy (default 3)
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold"`
+	// (optional) response status that `http` check expects (default 200)
+	ExpectedStatus int `mapstructure:"expected_status"`
+	// client identifier sent in `soap` check
+	Client common.ClientIdentifierConf `mapstructure:"client"`
+	// service identifier (of provider subsystem) sent in `soap` check. service_code defaults to `listMethods`
+	Service common.ServiceIdentifierConf `mapstructure:"service"`
 }
 
 // ServerStorageConf describes serve different storage configurations
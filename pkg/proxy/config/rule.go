@@ -1,5 +1,10 @@
 package config
 
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"time"
+)
+
 // RuleConfigs is collection type for RuleConf structure
 type RuleConfigs []RuleConf
 
@@ -7,27 +12,154 @@ type RuleConfigs []RuleConf
 type RuleConf struct {
 	// server name where to direct matched request. Must have matching value in ProxyServerConfigs.Name
 	Server string `mapstructure:"server"`
-	// full service name to match (subsystemCode.serviceCode.serviceVersion) (for example: rr.RR67_muutus.v1)
+	// weighted list of servers where to split matched requests between. Alternative to `server`
+	Servers WeightedServerConfigs `mapstructure:"servers"`
+	// (optional) keeps requests with same key on same server from `servers`. Possible values: `client` (client
+	// subsystem identifier) or `user_id`. Requests are distributed randomly by weight when omitted
+	StickyBy string `mapstructure:"sticky_by"`
+	// (optional) names of servers where matched request is sent when selected server is unhealthy. First healthy wins
+	FallbackServers []string `mapstructure:"fallback_servers"`
+	// (optional) names of servers where matched request is mirrored to asynchronously. Shadow responses are stored
+	// next to primary response for comparison but are never returned to client
+	ShadowServers []string `mapstructure:"shadow_servers"`
+	// service to match in short form (subsystemCode.serviceCode.serviceVersion) (for example: rr.RR67_muutus.v1)
+	// or in full form (instance/memberClass/memberCode/subsystemCode/serviceCode/serviceVersion)
 	Service string `mapstructure:"service"`
+	// service identifier to match by its parts. Alternative to `service`, omitted parts match any value
+	ServiceIdentifier common.ServiceIdentifierConf `mapstructure:"service_identifier"`
 	// priority defines in which order rules are matched. higher the better/sooner is rule matched
 	Priority int64 `mapstructure:"priority"`
-	// additional list of request remote addresses to decide if request is proxied to this service proxy
+	// additional list of request remote addresses (IPv4/IPv6 address or CIDR range) to decide if request is proxied to
+	// this service proxy. Client address is resolved from X-Forwarded-For/Forwarded headers for trusted proxies.
 	MatcherRemoteAddr []string `mapstructure:"request_matcher_remote_addr"`
 	// additional regex'es run on request to decide if request is proxied to this service proxy
 	MatcherRegex []string `mapstructure:"request_matcher_regexes"`
+	// additional XPath expressions run on request to decide if request is proxied to this service proxy
+	MatcherXPath []string `mapstructure:"request_matcher_xpaths"`
+	// (optional) namespace prefixes (prefix: namespace URI) used in XPath expressions of `request_matcher_xpaths` and
+	// `request_matcher`. Bound prefix matches element of that namespace regardless of prefix used in request. Config
+	// loader lowercases map keys so prefixes in YAML config must be lowercase
+	MatcherNamespaces map[string]string `mapstructure:"request_matcher_namespaces"`
+	// additional X-road SOAP header fields (client, userId etc) request must have to be proxied to this service proxy
+	MatcherHeader common.HeaderMatcherConf `mapstructure:"request_matcher_header"`
+	// additional matcher expression (tree of all/any/not groups) request must match to be proxied to this service proxy
+	Matcher common.MatcherConf `mapstructure:"request_matcher"`
 	// regex'es to replace contents of request before it is proxied
 	RequestReplacements ReplacementConfigs `mapstructure:"request_replacements"`
 	// regex'es to replace contents of proxied response
 	ResponseReplacements ReplacementConfigs `mapstructure:"response_replacements"`
+	// (optional) changes of HTTP headers of request before it is proxied
+	RequestHeaders HeaderOperationConfigs `mapstructure:"request_headers"`
+	// (optional) changes of HTTP headers of proxied response before it is returned to client
+	ResponseHeaders HeaderOperationConfigs `mapstructure:"response_headers"`
+	// (optional) test scenario rule is bound to. Rule is matched only for requests with same scenario in
+	// X-Mock-Scenario header. Rules without scenario are shared default for all requests
+	Scenario string `mapstructure:"scenario"`
+	// (optional) RFC3339 timestamp since when rule is active (for example: 2019-06-01T09:00:00+03:00)
+	ActiveFrom string `mapstructure:"active_from"`
+	// (optional) RFC3339 timestamp until when rule is active
+	ActiveUntil string `mapstructure:"active_until"`
+	// (optional) recurring windows '[days] HH:MM-HH:MM' in server local time when rule is active
+	// (for example: 'weekdays 09:00-11:00', 'mon,wed 13:00-14:00', 'sat-sun 22:00-02:00')
+	ActiveWindows []string `mapstructure:"active_windows"`
+	// (optional) number of times rule can be matched before it is removed
+	MaxMatches int64 `mapstructure:"max_matches"`
+	// (optional) duration (for example: 10m) after which rule is removed
+	TTL string `mapstructure:"ttl"`
+	// (optional) faults injected into fraction of matched requests instead of proxying them as is
+	Faults FaultsConf `mapstructure:"faults"`
+	// (optional) latency and bandwidth limits of matched requests. Set values override server `shaping`
+	Shaping ShapingConf `mapstructure:"shaping"`
 	// should rule be changeable in API (defaults to true)
 	IsReadOnly *bool `mapstructure:"read_only"`
 }
 
+// FaultsConf describes faults injected into matched requests. Each fault has probability (0.0-1.0) of being injected.
+// Latency is added independently of other faults, of other faults at most one is injected per request so sum of their
+// probabilities can not exceed 1
+type FaultsConf struct {
+	// delay before request is proxied
+	Latency LatencyFaultConf `mapstructure:"latency"`
+	// respond immediately with HTTP error status without proxying request
+	ErrorStatus ErrorStatusFaultConf `mapstructure:"error_status"`
+	// close client connection with TCP reset without proxying request
+	ConnectionReset ProbabilityConf `mapstructure:"connection_reset"`
+	// proxy request but respond with empty body
+	EmptyBody ProbabilityConf `mapstructure:"empty_body"`
+	// proxy request but send only first half of response body and close connection
+	TruncatedBody ProbabilityConf `mapstructure:"truncated_body"`
+	// respond with X-road SOAP fault without proxying request
+	SOAPFault SOAPFaultConf `mapstructure:"soap_fault"`
+}
+
+// ProbabilityConf describes how likely fault is injected
+type ProbabilityConf struct {
+	Probability float64 `mapstructure:"probability"`
+}
+
+// LatencyFaultConf describes latency added to requests
+type LatencyFaultConf struct {
+	Probability float64 `mapstructure:"probability"`
+	// how long request is delayed (for example: 2s)
+	Duration time.Duration `mapstructure:"duration"`
+}
+
+// ErrorStatusFaultConf describes HTTP error responses
+type ErrorStatusFaultConf struct {
+	Probability float64 `mapstructure:"probability"`
+	// (optional) HTTP status code of response (default 503)
+	Status int `mapstructure:"status"`
+}
+
+// SOAPFaultConf describes SOAP fault responses
+type SOAPFaultConf struct {
+	Probability float64 `mapstructure:"probability"`
+	// (optional) fault code (default Server.ClientProxy.InternalError)
+	FaultCode string `mapstructure:"fault_code"`
+	// (optional) fault string (default 'injected fault')
+	FaultString string `mapstructure:"fault_string"`
+}
+
+// WeightedServerConfigs is collection type for WeightedServerConf structures
+type WeightedServerConfigs []WeightedServerConf
+
+// WeightedServerConf describes server and share of traffic it receives
+type WeightedServerConf struct {
+	// server name. Must have matching value in ProxyServerConfigs.Name
+	Name string `mapstructure:"name"`
+	// relative weight of server. Server receives weight/sum(weights) share of requests
+	Weight int `mapstructure:"weight"`
+}
+
+// HeaderOperationConfigs is collection type for HeaderOperationConf structures
+type HeaderOperationConfigs []HeaderOperationConf
+
+// HeaderOperationConf describes change of single HTTP header
+type HeaderOperationConf struct {
+	// `add` (keeps existing values), `set` (replaces existing values) or `remove`
+	Operation string `mapstructure:"operation"`
+	// header name (for example: X-Road-Client)
+	Name string `mapstructure:"name"`
+	// header value. Can be Go template referencing request data (for example: '{{ .Header.Client.MemberCode }}',
+	// '{{ .Server }}', '{{ .RequestID }}')
+	Value string `mapstructure:"value"`
+}
+
 // ReplacementConfigs is collection type for ReplacementConf structures
 type ReplacementConfigs []ReplacementConf
 
-// ReplacementConf describes rules for replacing things in request/response
+// ReplacementConf describes rules for replacing things in request/response. Replacement is either regex run on raw
+// body or structured rewrite of nodes selected by XPath expression
 type ReplacementConf struct {
 	Regex string `mapstructure:"regex"`
+	// replacement value for regex. For XPath rewrites new text/attribute value (`set`), XML fragment (`insert`) or
+	// new namespace prefix (`rename_prefix`)
 	Value string `mapstructure:"value"`
+	// XPath expression selecting elements, attributes or text nodes to rewrite. Alternative to `regex`
+	XPath string `mapstructure:"xpath"`
+	// (optional) XPath rewrite operation: `set` (default), `remove`, `insert` (fragment as last child) or
+	// `rename_prefix` (within selected elements, whole document when xpath is omitted)
+	Operation string `mapstructure:"operation"`
+	// namespace prefix renamed by `rename_prefix` operation
+	Prefix string `mapstructure:"prefix"`
 }
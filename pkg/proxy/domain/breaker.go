@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is state of circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets all requests through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails all requests without sending them to server
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets limited number of trial requests through to decide if circuit can be closed
+	CircuitHalfOpen CircuitState = "half_open"
+
+	defaultCircuitOpenTimeout      = 30 * time.Second
+	defaultCircuitHalfOpenRequests = 1
+	defaultCircuitSuccessThreshold = 1
+)
+
+var defaultCircuitFailureStatus = []int{502, 503, 504}
+
+// CircuitBreakerSettings describes when circuit breaker opens and closes
+type CircuitBreakerSettings struct {
+	FailureThreshold int
+	SuccessThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	FailureStatus    []int
+}
+
+// CircuitBreaker stops sending requests to server after consecutive failures. State is shared between copies of
+// same server
+type CircuitBreaker struct {
+	Settings CircuitBreakerSettings
+
+	mutex     sync.Mutex
+	state     CircuitState
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+}
+
+// CircuitStatus is snapshot of circuit breaker state
+type CircuitStatus struct {
+	State    CircuitState
+	Failures int
+	OpenedAt time.Time
+}
+
+// StateChange describes circuit breaker state transition
+type StateChange struct {
+	From CircuitState
+	To   CircuitState
+}
+
+// IsChanged returns true when state actually changed
+func (c StateChange) IsChanged() bool {
+	return c.From != c.To
+}
+
+// ConvertCircuitBreaker converts circuit breaker configuration to domain object. Nil is returned when circuit breaker is
+// not configured
+func ConvertCircuitBreaker(conf config.CircuitBreakerConf) (*CircuitBreaker, error) {
+	if conf.FailureThreshold == 0 {
+		return nil, nil
+	}
+	if conf.FailureThreshold < 0 || conf.SuccessThreshold < 0 || conf.OpenTimeout < 0 || conf.HalfOpenRequests < 0 {
+		return nil, errors.New("circuit_breaker thresholds, open_timeout and half_open_requests can not be negative")
+	}
+
+	settings := CircuitBreakerSettings{
+		FailureThreshold: conf.FailureThreshold,
+		SuccessThreshold: conf.SuccessThreshold,
+		OpenTimeout:      conf.OpenTimeout,
+		HalfOpenRequests: conf.HalfOpenRequests,
+		FailureStatus:    conf.FailureStatus,
+	}
+	if settings.SuccessThreshold == 0 {
+		settings.SuccessThreshold = defaultCircuitSuccessThreshold
+	}
+	if settings.OpenTimeout == 0 {
+		settings.OpenTimeout = defaultCircuitOpenTimeout
+	}
+	if settings.HalfOpenRequests == 0 {
+		settings.HalfOpenRequests = defaultCircuitHalfOpenRequests
+	}
+	if len(settings.FailureStatus) == 0 {
+		settings.FailureStatus = defaultCircuitFailureStatus
+	}
+	return NewCircuitBreaker(settings), nil
+}
+
+// NewCircuitBreaker creates closed circuit breaker
+func NewCircuitBreaker(settings CircuitBreakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{
+		Settings: settings,
+		state:    CircuitClosed,
+	}
+}
+
+// Allow returns true when request can be sent to server. Open circuit becomes half-open after open timeout has passed
+// and lets limited number of trial requests through
+func (b *CircuitBreaker) Allow(now time.Time) (bool, StateChange) {
+	if b == nil {
+		return true, StateChange{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	change := StateChange{From: b.state, To: b.state}
+	if b.state == CircuitOpen {
+		if now.Sub(b.openedAt) < b.Settings.OpenTimeout {
+			return false, change
+		}
+		b.setState(CircuitHalfOpen, now)
+		change.To = CircuitHalfOpen
+	}
+	if b.state == CircuitHalfOpen {
+		if b.inFlight >= b.Settings.HalfOpenRequests {
+			return false, change
+		}
+		b.inFlight++
+	}
+	return true, change
+}
+
+// IsFailureStatus returns true when response status code is counted as failure
+func (b *CircuitBreaker) IsFailureStatus(statusCode int) bool {
+	if b == nil {
+		return false
+	}
+	for _, s := range b.Settings.FailureStatus {
+		if s == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Report records result of request that Allow let through
+func (b *CircuitBreaker) Report(success bool, now time.Time) StateChange {
+	if b == nil {
+		return StateChange{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	change := StateChange{From: b.state, To: b.state}
+	switch b.state {
+	case CircuitClosed:
+		if success {
+			b.failures = 0
+			break
+		}
+		b.failures++
+		if b.failures >= b.Settings.FailureThreshold {
+			b.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+		if !success {
+			b.failures++
+			b.setState(CircuitOpen, now)
+			break
+		}
+		b.successes++
+		if b.successes >= b.Settings.SuccessThreshold {
+			b.setState(CircuitClosed, now)
+		}
+	}
+	change.To = b.state
+	return change
+}
+
+// Release frees half-open trial slot of request that Allow let through without recording its result. Used for
+// requests that were cancelled by client and therefore say nothing about server state
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitHalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+func (b *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	b.state = state
+	b.successes = 0
+	b.inFlight = 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = now
+	case CircuitClosed:
+		b.failures = 0
+		b.openedAt = time.Time{}
+	}
+}
+
+// Status returns snapshot of circuit breaker state
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return CircuitStatus{
+		State:    b.state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerSettings{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 1,
+	})
+	now := time.Now()
+
+	allowed, _ := breaker.Allow(now)
+	assert.True(t, allowed)
+	assert.False(t, breaker.Report(false, now).IsChanged())
+
+	change := breaker.Report(false, now)
+	assert.Equal(t, StateChange{From: CircuitClosed, To: CircuitOpen}, change)
+
+	allowed, _ = breaker.Allow(now.Add(30 * time.Second))
+	assert.False(t, allowed)
+
+	// open timeout passed, single trial request is let through
+	allowed, change = breaker.Allow(now.Add(time.Minute))
+	assert.True(t, allowed)
+	assert.Equal(t, StateChange{From: CircuitOpen, To: CircuitHalfOpen}, change)
+	allowed, _ = breaker.Allow(now.Add(time.Minute))
+	assert.False(t, allowed)
+
+	change = breaker.Report(true, now.Add(time.Minute))
+	assert.Equal(t, StateChange{From: CircuitHalfOpen, To: CircuitClosed}, change)
+	assert.Equal(t, CircuitStatus{State: CircuitClosed}, breaker.Status())
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 1, SuccessThreshold: 1, OpenTimeout: time.Second, HalfOpenRequests: 1})
+	now := time.Now()
+
+	breaker.Report(false, now)
+	allowed, _ := breaker.Allow(now.Add(time.Second))
+	assert.True(t, allowed)
+
+	change := breaker.Report(false, now.Add(time.Second))
+	assert.Equal(t, StateChange{From: CircuitHalfOpen, To: CircuitOpen}, change)
+	assert.Equal(t, now.Add(time.Second), breaker.Status().OpenedAt)
+}
+
+func TestCircuitBreakerReleaseKeepsState(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 2, SuccessThreshold: 1, OpenTimeout: time.Second, HalfOpenRequests: 1})
+	now := time.Now()
+
+	breaker.Report(false, now)
+	breaker.Release()
+	assert.Equal(t, 1, breaker.Status().Failures)
+
+	breaker.Report(false, now)
+	allowed, _ := breaker.Allow(now.Add(time.Second))
+	assert.True(t, allowed)
+
+	breaker.Release()
+	assert.Equal(t, CircuitHalfOpen, breaker.Status().State)
+	allowed, _ = breaker.Allow(now.Add(time.Second))
+	assert.True(t, allowed)
+}
+
+func TestConvertCircuitBreaker(t *testing.T) {
+	breaker, err := ConvertCircuitBreaker(config.CircuitBreakerConf{})
+	assert.NoError(t, err)
+	assert.Nil(t, breaker)
+
+	breaker, err = ConvertCircuitBreaker(config.CircuitBreakerConf{FailureThreshold: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitBreakerSettings{
+		FailureThreshold: 5,
+		SuccessThreshold: 1,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+		FailureStatus:    []int{502, 503, 504},
+	}, breaker.Settings)
+
+	_, err = ConvertCircuitBreaker(config.CircuitBreakerConf{FailureThreshold: 5, OpenTimeout: -1})
+	assert.EqualError(t, err, "circuit_breaker thresholds, open_timeout and half_open_requests can not be negative")
+}
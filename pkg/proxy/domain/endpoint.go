@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"github.com/pkg/errors"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// LoadBalancingRoundRobin sends requests to endpoints in turns
+	LoadBalancingRoundRobin = "round_robin"
+	// LoadBalancingLeastConn sends request to endpoint with least active requests
+	LoadBalancingLeastConn = "least_conn"
+	// LoadBalancingRandom sends request to random endpoint
+	LoadBalancingRandom = "random"
+)
+
+// Endpoint is single address of proxy server
+type Endpoint struct {
+	Address url.URL
+	Health  *HealthState
+	active  int64
+}
+
+// EndpointPool is set of proxy server endpoints that requests are balanced between. Pool is shared between copies of
+// same server
+type EndpointPool struct {
+	Strategy  string
+	Endpoints []*Endpoint
+	next      uint64
+}
+
+// NewEndpointPool creates endpoint pool for given addresses and load balancing strategy (round_robin by default)
+func NewEndpointPool(strategy string, addresses []url.URL) (*EndpointPool, error) {
+	strategy = strings.ToLower(strategy)
+	switch strategy {
+	case "":
+		strategy = LoadBalancingRoundRobin
+	case LoadBalancingRoundRobin, LoadBalancingLeastConn, LoadBalancingRandom:
+	default:
+		return nil, errors.Errorf("invalid load_balancing value '%v', expected 'round_robin', 'least_conn' or 'random'", strategy)
+	}
+
+	pool := EndpointPool{Strategy: strategy}
+	for _, address := range addresses {
+		pool.Endpoints = append(pool.Endpoints, &Endpoint{Address: address, Health: NewHealthState()})
+	}
+	return &pool, nil
+}
+
+// ActiveRequests returns number of requests currently sent to endpoint
+func (e *Endpoint) ActiveRequests() int64 {
+	return atomic.LoadInt64(&e.active)
+}
+
+// Acquire marks request being sent to endpoint
+func (e *Endpoint) Acquire() {
+	atomic.AddInt64(&e.active, 1)
+}
+
+// Release marks request sent to endpoint being finished
+func (e *Endpoint) Release() {
+	atomic.AddInt64(&e.active, -1)
+}
+
+// IsHealthy returns true when any of endpoints is healthy. Empty pool is always healthy
+func (p *EndpointPool) IsHealthy() bool {
+	if p == nil || len(p.Endpoints) == 0 {
+		return true
+	}
+	for _, e := range p.Endpoints {
+		if e.Health.IsHealthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns endpoint for next request by pool strategy. Unhealthy endpoints are skipped unless all endpoints
+// are unhealthy. Returns nil for empty pool
+func (p *EndpointPool) Select() *Endpoint {
+	if p == nil || len(p.Endpoints) == 0 {
+		return nil
+	}
+	candidates := make([]*Endpoint, 0, len(p.Endpoints))
+	for _, e := range p.Endpoints {
+		if e.Health.IsHealthy() {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.Endpoints
+	}
+
+	switch p.Strategy {
+	case LoadBalancingLeastConn:
+		selected := candidates[0]
+		for _, e := range candidates[1:] {
+			if e.ActiveRequests() < selected.ActiveRequests() {
+				selected = e
+			}
+		}
+		return selected
+	case LoadBalancingRandom:
+		return candidates[rand.Intn(len(candidates))]
+	default:
+		next := atomic.AddUint64(&p.next, 1) - 1
+		return candidates[next%uint64(len(candidates))]
+	}
+}
+
+// FindByHost returns endpoint with given host
+func (p *EndpointPool) FindByHost(host string) (*Endpoint, bool) {
+	if p == nil {
+		return nil, false
+	}
+	for _, e := range p.Endpoints {
+		// NB: Address.Host contains already port. ie. 'localhost:443'
+		if e.Address.Host == host {
+			return e, true
+		}
+	}
+	return nil, false
+}
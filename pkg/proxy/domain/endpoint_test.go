@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolSelectRoundRobin(t *testing.T) {
+	pool := testEndpointPool(t, LoadBalancingRoundRobin)
+
+	assert.Equal(t, "a:80", pool.Select().Address.Host)
+	assert.Equal(t, "b:80", pool.Select().Address.Host)
+	assert.Equal(t, "c:80", pool.Select().Address.Host)
+	assert.Equal(t, "a:80", pool.Select().Address.Host)
+}
+
+func TestEndpointPoolSelectSkipsUnhealthy(t *testing.T) {
+	pool := testEndpointPool(t, LoadBalancingRoundRobin)
+	pool.Endpoints[1].Health.Report(errors.New("connection refused"), time.Now(), 1, 1)
+
+	for i := 0; i < 4; i++ {
+		assert.NotEqual(t, "b:80", pool.Select().Address.Host)
+	}
+	assert.True(t, pool.IsHealthy())
+
+	// when all endpoints are unhealthy any of them is still used
+	pool.Endpoints[0].Health.Report(errors.New("connection refused"), time.Now(), 1, 1)
+	pool.Endpoints[2].Health.Report(errors.New("connection refused"), time.Now(), 1, 1)
+	assert.False(t, pool.IsHealthy())
+	assert.NotNil(t, pool.Select())
+}
+
+func TestEndpointPoolSelectLeastConn(t *testing.T) {
+	pool := testEndpointPool(t, LoadBalancingLeastConn)
+	pool.Endpoints[0].Acquire()
+	pool.Endpoints[0].Acquire()
+	pool.Endpoints[1].Acquire()
+
+	assert.Equal(t, "c:80", pool.Select().Address.Host)
+
+	pool.Endpoints[0].Release()
+	pool.Endpoints[0].Release()
+	assert.Equal(t, "a:80", pool.Select().Address.Host)
+}
+
+func TestNewEndpointPoolInvalidStrategy(t *testing.T) {
+	_, err := NewEndpointPool("fastest", nil)
+
+	assert.EqualError(t, err, "invalid load_balancing value 'fastest', expected 'round_robin', 'least_conn' or 'random'")
+}
+
+func TestParseAddresses(t *testing.T) {
+	addresses, err := ParseAddresses("", []string{"https://ss1:443", "https://ss2:443"})
+	assert.NoError(t, err)
+	assert.Len(t, addresses, 2)
+	assert.Equal(t, "ss2:443", addresses[1].Host)
+
+	_, err = ParseAddresses("https://ss1:443", []string{"https://ss2:443"})
+	assert.EqualError(t, err, "address and endpoints can not be both set")
+}
+
+func testEndpointPool(t *testing.T, strategy string) *EndpointPool {
+	var addresses []url.URL
+	for _, a := range []string{"http://a:80", "http://b:80", "http://c:80"} {
+		u, err := url.Parse(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses = append(addresses, *u)
+	}
+	pool, err := NewEndpointPool(strategy, addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
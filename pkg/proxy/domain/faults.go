@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	// FaultErrorStatus responds with HTTP error status without proxying request
+	FaultErrorStatus = "error_status"
+	// FaultConnectionReset resets client connection without proxying request
+	FaultConnectionReset = "connection_reset"
+	// FaultEmptyBody proxies request but responds with empty body
+	FaultEmptyBody = "empty_body"
+	// FaultTruncatedBody proxies request but sends only first half of response body
+	FaultTruncatedBody = "truncated_body"
+	// FaultSOAPFault responds with SOAP fault without proxying request
+	FaultSOAPFault = "soap_fault"
+
+	defaultFaultErrorStatus = 503
+	defaultFaultString      = "injected fault"
+)
+
+// Faults describes faults injected into requests matched by rule
+type Faults struct {
+	Latency         LatencyFault
+	ErrorStatus     ErrorStatusFault
+	ConnectionReset float64
+	EmptyBody       float64
+	TruncatedBody   float64
+	SOAPFault       SOAPFault
+}
+
+// LatencyFault delays request before it is proxied
+type LatencyFault struct {
+	Probability float64
+	Duration    time.Duration
+}
+
+// ErrorStatusFault responds with HTTP error status
+type ErrorStatusFault struct {
+	Probability float64
+	Status      int
+}
+
+// SOAPFault responds with SOAP fault
+type SOAPFault struct {
+	Probability float64
+	FaultCode   string
+	FaultString string
+}
+
+// InjectedFault is outcome of rolling rule faults for single request. Empty Kind means request is proxied (after
+// Latency) as is
+type InjectedFault struct {
+	Kind        string
+	Latency     time.Duration
+	Status      int
+	FaultCode   string
+	FaultString string
+}
+
+// ConvertFaults converts fault configuration to domain object
+func ConvertFaults(conf config.FaultsConf) (Faults, error) {
+	probabilities := []float64{
+		conf.Latency.Probability,
+		conf.ErrorStatus.Probability,
+		conf.ConnectionReset.Probability,
+		conf.EmptyBody.Probability,
+		conf.TruncatedBody.Probability,
+		conf.SOAPFault.Probability,
+	}
+	for _, p := range probabilities {
+		if p < 0 || p > 1 {
+			return Faults{}, errors.Errorf("fault probability must be between 0 and 1, got %v", p)
+		}
+	}
+	if sum(probabilities[1:]) > 1 {
+		return Faults{}, errors.New("sum of fault probabilities (excluding latency) can not exceed 1")
+	}
+	if conf.Latency.Probability > 0 && conf.Latency.Duration <= 0 {
+		return Faults{}, errors.New("latency fault duration must be larger than 0")
+	}
+
+	status := conf.ErrorStatus.Status
+	if status == 0 {
+		status = defaultFaultErrorStatus
+	}
+	if status < 400 || status > 599 {
+		return Faults{}, errors.Errorf("error_status fault status must be between 400 and 599, got %v", status)
+	}
+
+	faultCode := conf.SOAPFault.FaultCode
+	if faultCode == "" {
+		faultCode = soap.FaultCodeInternalError
+	}
+	faultString := conf.SOAPFault.FaultString
+	if faultString == "" {
+		faultString = defaultFaultString
+	}
+
+	return Faults{
+		Latency:         LatencyFault{Probability: conf.Latency.Probability, Duration: conf.Latency.Duration},
+		ErrorStatus:     ErrorStatusFault{Probability: conf.ErrorStatus.Probability, Status: status},
+		ConnectionReset: conf.ConnectionReset.Probability,
+		EmptyBody:       conf.EmptyBody.Probability,
+		TruncatedBody:   conf.TruncatedBody.Probability,
+		SOAPFault: SOAPFault{
+			Probability: conf.SOAPFault.Probability,
+			FaultCode:   faultCode,
+			FaultString: faultString,
+		},
+	}, nil
+}
+
+func sum(values []float64) float64 {
+	result := 0.0
+	for _, v := range values {
+		result += v
+	}
+	return result
+}
+
+// IsEmpty returns true when no fault can be injected
+func (f Faults) IsEmpty() bool {
+	return f.Latency.Probability == 0 && f.ErrorStatus.Probability == 0 && f.ConnectionReset == 0 &&
+		f.EmptyBody == 0 && f.TruncatedBody == 0 && f.SOAPFault.Probability == 0
+}
+
+// Roll decides which faults are injected into request. random returns values in [0.0, 1.0) (for example
+// rand.Float64). Latency is rolled separately, other faults share single roll so at most one of them is injected
+func (f Faults) Roll(random func() float64) InjectedFault {
+	result := InjectedFault{}
+	if f.IsEmpty() {
+		return result
+	}
+	if f.Latency.Probability > 0 && random() < f.Latency.Probability {
+		result.Latency = f.Latency.Duration
+	}
+
+	roll := random()
+	limit := 0.0
+	for _, candidate := range []struct {
+		kind        string
+		probability float64
+	}{
+		{FaultErrorStatus, f.ErrorStatus.Probability},
+		{FaultConnectionReset, f.ConnectionReset},
+		{FaultEmptyBody, f.EmptyBody},
+		{FaultTruncatedBody, f.TruncatedBody},
+		{FaultSOAPFault, f.SOAPFault.Probability},
+	} {
+		limit += candidate.probability
+		if candidate.probability > 0 && roll < limit {
+			result.Kind = candidate.kind
+			break
+		}
+	}
+
+	switch result.Kind {
+	case FaultErrorStatus:
+		result.Status = f.ErrorStatus.Status
+	case FaultSOAPFault:
+		result.FaultCode = f.SOAPFault.FaultCode
+		result.FaultString = f.SOAPFault.FaultString
+	}
+	return result
+}
+
+// IsEmpty returns true when nothing is injected
+func (f InjectedFault) IsEmpty() bool {
+	return f.Kind == "" && f.Latency == 0
+}
+
+// String describes injected fault for logging and storing with request
+func (f InjectedFault) String() string {
+	if f.Latency == 0 {
+		return f.Kind
+	}
+	if f.Kind == "" {
+		return "latency " + f.Latency.String()
+	}
+	return "latency " + f.Latency.String() + ", " + f.Kind
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestConvertFaults(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		conf          config.FaultsConf
+		expected      Faults
+		expectedError string
+	}{
+		{
+			name: "ok, defaults",
+			conf: config.FaultsConf{
+				ErrorStatus: config.ErrorStatusFaultConf{Probability: 0.1},
+				SOAPFault:   config.SOAPFaultConf{Probability: 0.2},
+			},
+			expected: Faults{
+				ErrorStatus: ErrorStatusFault{Probability: 0.1, Status: 503},
+				SOAPFault:   SOAPFault{Probability: 0.2, FaultCode: soap.FaultCodeInternalError, FaultString: "injected fault"},
+			},
+		},
+		{
+			name:          "nok, probability out of range",
+			conf:          config.FaultsConf{EmptyBody: config.ProbabilityConf{Probability: 1.5}},
+			expectedError: "fault probability must be between 0 and 1, got 1.5",
+		},
+		{
+			name: "nok, probabilities sum over 1",
+			conf: config.FaultsConf{
+				EmptyBody:     config.ProbabilityConf{Probability: 0.6},
+				TruncatedBody: config.ProbabilityConf{Probability: 0.6},
+			},
+			expectedError: "sum of fault probabilities (excluding latency) can not exceed 1",
+		},
+		{
+			name:          "nok, latency without duration",
+			conf:          config.FaultsConf{Latency: config.LatencyFaultConf{Probability: 0.5}},
+			expectedError: "latency fault duration must be larger than 0",
+		},
+		{
+			name:          "nok, status not error",
+			conf:          config.FaultsConf{ErrorStatus: config.ErrorStatusFaultConf{Probability: 0.5, Status: 200}},
+			expectedError: "error_status fault status must be between 400 and 599, got 200",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			faults, err := ConvertFaults(tc.conf)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, faults)
+		})
+	}
+}
+
+func TestFaultsRoll(t *testing.T) {
+	faults := Faults{
+		Latency:       LatencyFault{Probability: 0.5, Duration: time.Second},
+		ErrorStatus:   ErrorStatusFault{Probability: 0.2, Status: 502},
+		TruncatedBody: 0.3,
+	}
+
+	var testCases = []struct {
+		name     string
+		rolls    []float64
+		expected InjectedFault
+	}{
+		{
+			name:     "latency and error status",
+			rolls:    []float64{0.1, 0.1},
+			expected: InjectedFault{Kind: FaultErrorStatus, Latency: time.Second, Status: 502},
+		},
+		{
+			name:     "truncated body",
+			rolls:    []float64{0.9, 0.4},
+			expected: InjectedFault{Kind: FaultTruncatedBody},
+		},
+		{
+			name:     "nothing",
+			rolls:    []float64{0.9, 0.5},
+			expected: InjectedFault{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rolls := tc.rolls
+			random := func() float64 {
+				r := rolls[0]
+				rolls = rolls[1:]
+				return r
+			}
+
+			assert.Equal(t, tc.expected, faults.Roll(random))
+		})
+	}
+}
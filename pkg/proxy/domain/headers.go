@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+const (
+	// HeaderAdd adds value to header keeping its existing values
+	HeaderAdd = "add"
+	// HeaderSet replaces all values of header with value
+	HeaderSet = "set"
+	// HeaderRemove removes header
+	HeaderRemove = "remove"
+)
+
+// HeaderOperations is collection type for HeaderOperation structures
+type HeaderOperations []HeaderOperation
+
+// HeaderOperation describes change of single HTTP header
+type HeaderOperation struct {
+	Operation string
+	Name      string
+	Value     Template
+}
+
+// ConvertHeaderOperations converts header operation configuration to domain objects
+func ConvertHeaderOperations(conf config.HeaderOperationConfigs) (HeaderOperations, error) {
+	result := HeaderOperations{}
+	for _, c := range conf {
+		o, err := NewHeaderOperation(c.Operation, c.Name, c.Value)
+		if err != nil {
+			return HeaderOperations{}, err
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+// NewHeaderOperation creates header operation. Value can be Go template referencing request data (TemplateData)
+func NewHeaderOperation(operation string, name string, value string) (HeaderOperation, error) {
+	switch operation {
+	case HeaderAdd, HeaderSet, HeaderRemove:
+	default:
+		return HeaderOperation{}, errors.Errorf("invalid header operation '%v', expected 'add', 'set' or 'remove'", operation)
+	}
+	if name == "" {
+		return HeaderOperation{}, errors.New("header operation name can not be empty")
+	}
+	t, err := NewTemplate(value)
+	if err != nil {
+		return HeaderOperation{}, err
+	}
+	return HeaderOperation{
+		Operation: operation,
+		Name:      http.CanonicalHeaderKey(name),
+		Value:     t,
+	}, nil
+}
+
+// Apply applies operations in order to header. Operations with values failing to render are skipped and their
+// errors returned
+func (o HeaderOperations) Apply(header http.Header, data TemplateData) []error {
+	var errs []error
+	for _, op := range o {
+		if op.Operation == HeaderRemove {
+			header.Del(op.Name)
+			continue
+		}
+		value, err := op.Value.Render(data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if op.Operation == HeaderSet {
+			header.Set(op.Name, value)
+		} else {
+			header.Add(op.Name, value)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHeaderOperationsApply(t *testing.T) {
+	operations, err := ConvertHeaderOperations(config.HeaderOperationConfigs{
+		{Operation: HeaderSet, Name: "x-road-client", Value: "{{ .Header.Client.XRoadInstance }}/{{ .Header.Client.MemberCode }}"},
+		{Operation: HeaderAdd, Name: "X-Routed-To", Value: "{{ .Server }}"},
+		{Operation: HeaderRemove, Name: "Cookie"},
+		{Operation: HeaderSet, Name: "X-Broken", Value: "{{ .Missing }}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{
+		"Cookie":      []string{"session=1"},
+		"X-Routed-To": []string{"proxy"},
+	}
+	data := TemplateData{
+		Server: "real-xroad",
+		Header: soap.Header{Client: soap.ClientIdentifier{XRoadInstance: "ee-test", MemberCode: "70009999"}},
+	}
+
+	errs := operations.Apply(header, data)
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, http.Header{
+		"X-Road-Client": []string{"ee-test/70009999"},
+		"X-Routed-To":   []string{"proxy", "real-xroad"},
+	}, header)
+}
+
+func TestNewHeaderOperationInvalid(t *testing.T) {
+	_, err := NewHeaderOperation("replace", "Cookie", "")
+	assert.EqualError(t, err, "invalid header operation 'replace', expected 'add', 'set' or 'remove'")
+
+	_, err = NewHeaderOperation(HeaderSet, "X-Test", "{{ .Server")
+	assert.EqualError(t, err, "failed to parse value template '{{ .Server': template: value:1: unclosed action")
+}
@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthCheckHTTP checks server health with HTTP GET request
+	HealthCheckHTTP = "http"
+	// HealthCheckTCP checks server health by opening TCP connection
+	HealthCheckTCP = "tcp"
+	// HealthCheckSOAP checks server health with X-road metaservice (listMethods) request
+	HealthCheckSOAP = "soap"
+
+	defaultHealthCheckInterval       = 10 * time.Second
+	defaultHealthCheckTimeout        = 5 * time.Second
+	defaultHealthyThreshold          = 1
+	defaultUnhealthyThreshold        = 3
+	defaultHealthCheckServiceCode    = "listMethods"
+	defaultHealthCheckExpectedStatus = 200
+)
+
+// HealthCheck describes how and how often server health is checked
+type HealthCheck struct {
+	Type               string
+	Path               string
+	Interval           time.Duration
+	Timeout            time.Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	ExpectedStatus     int
+	Client             soap.ClientIdentifier
+	Service            soap.ServiceIdentifier
+}
+
+// HealthState holds health of server. State is shared between copies of same server
+type HealthState struct {
+	mutex     sync.RWMutex
+	healthy   bool
+	checkedAt time.Time
+	lastError string
+	successes int
+	failures  int
+}
+
+// HealthStatus is snapshot of server health state
+type HealthStatus struct {
+	Healthy   bool
+	CheckedAt time.Time
+	Error     string
+}
+
+// IsEmpty returns true when health check is not configured
+func (c HealthCheck) IsEmpty() bool {
+	return c.Type == ""
+}
+
+func convertHealthCheck(conf config.HealthCheckConf) (HealthCheck, error) {
+	checkType := strings.ToLower(conf.Type)
+	switch checkType {
+	case "":
+		return HealthCheck{}, nil
+	case HealthCheckHTTP, HealthCheckTCP, HealthCheckSOAP:
+	default:
+		return HealthCheck{}, errors.Errorf("invalid health_check type '%v', expected 'http', 'tcp' or 'soap'", conf.Type)
+	}
+	if conf.Interval < 0 || conf.Timeout < 0 || conf.HealthyThreshold < 0 || conf.UnhealthyThreshold < 0 {
+		return HealthCheck{}, errors.New("health_check interval, timeout and thresholds can not be negative")
+	}
+
+	check := HealthCheck{
+		Type:               checkType,
+		Path:               conf.Path,
+		Interval:           conf.Interval,
+		Timeout:            conf.Timeout,
+		HealthyThreshold:   conf.HealthyThreshold,
+		UnhealthyThreshold: conf.UnhealthyThreshold,
+		ExpectedStatus:     conf.ExpectedStatus,
+		Client:             matcher.ClientFromConf(conf.Client),
+		Service: soap.ServiceIdentifier{
+			XRoadInstance:  conf.Service.XRoadInstance,
+			MemberClass:    conf.Service.MemberClass,
+			MemberCode:     conf.Service.MemberCode,
+			SubsystemCode:  conf.Service.SubsystemCode,
+			ServiceCode:    conf.Service.ServiceCode,
+			ServiceVersion: conf.Service.ServiceVersion,
+		},
+	}
+	if check.Interval == 0 {
+		check.Interval = defaultHealthCheckInterval
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultHealthCheckTimeout
+	}
+	if check.HealthyThreshold == 0 {
+		check.HealthyThreshold = defaultHealthyThreshold
+	}
+	if check.UnhealthyThreshold == 0 {
+		check.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if check.ExpectedStatus == 0 {
+		check.ExpectedStatus = defaultHealthCheckExpectedStatus
+	}
+	if check.Type == HealthCheckSOAP {
+		if check.Service.ServiceCode == "" {
+			check.Service.ServiceCode = defaultHealthCheckServiceCode
+		}
+		if check.Client.MemberCode == "" || check.Service.MemberCode == "" {
+			return HealthCheck{}, errors.New("soap health_check must have client and service set")
+		}
+	}
+	return check, nil
+}
+
+// NewHealthState creates health state for server. Servers are considered healthy until checks prove otherwise
+func NewHealthState() *HealthState {
+	return &HealthState{healthy: true}
+}
+
+// IsHealthy returns true when server is healthy. Server without health state is always healthy
+func (h *HealthState) IsHealthy() bool {
+	if h == nil {
+		return true
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.healthy
+}
+
+// Status returns snapshot of health state
+func (h *HealthState) Status() HealthStatus {
+	if h == nil {
+		return HealthStatus{Healthy: true}
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return HealthStatus{
+		Healthy:   h.healthy,
+		CheckedAt: h.checkedAt,
+		Error:     h.lastError,
+	}
+}
+
+// Report records health check result. State changes after threshold of consecutive successes/failures is reached
+func (h *HealthState) Report(checkErr error, now time.Time, healthyThreshold int, unhealthyThreshold int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.checkedAt = now
+	if checkErr == nil {
+		h.lastError = ""
+		h.failures = 0
+		h.successes++
+		if !h.healthy && h.successes >= healthyThreshold {
+			h.healthy = true
+		}
+		return
+	}
+
+	h.lastError = checkErr.Error()
+	h.successes = 0
+	h.failures++
+	if h.healthy && h.failures >= unhealthyThreshold {
+		h.healthy = false
+	}
+}
@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/config/common"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHealthStateReport(t *testing.T) {
+	state := NewHealthState()
+	now := time.Now()
+	checkErr := errors.New("connection refused")
+
+	state.Report(checkErr, now, 2, 2)
+	assert.True(t, state.IsHealthy())
+
+	state.Report(checkErr, now, 2, 2)
+	assert.False(t, state.IsHealthy())
+	assert.Equal(t, HealthStatus{Healthy: false, CheckedAt: now, Error: "connection refused"}, state.Status())
+
+	state.Report(nil, now, 2, 2)
+	assert.False(t, state.IsHealthy())
+
+	state.Report(nil, now, 2, 2)
+	assert.True(t, state.IsHealthy())
+	assert.Equal(t, "", state.Status().Error)
+}
+
+func TestHealthStateNilIsHealthy(t *testing.T) {
+	var state *HealthState
+
+	assert.True(t, state.IsHealthy())
+	assert.True(t, state.Status().Healthy)
+}
+
+func TestConvertHealthCheck(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		conf          config.HealthCheckConf
+		expected      HealthCheck
+		expectedError string
+	}{
+		{
+			name:     "ok, no health check",
+			expected: HealthCheck{},
+		},
+		{
+			name: "ok, http with defaults",
+			conf: config.HealthCheckConf{Type: "HTTP", Path: "/health"},
+			expected: HealthCheck{
+				Type:               HealthCheckHTTP,
+				Path:               "/health",
+				Interval:           10 * time.Second,
+				Timeout:            5 * time.Second,
+				HealthyThreshold:   1,
+				UnhealthyThreshold: 3,
+				ExpectedStatus:     200,
+			},
+		},
+		{
+			name: "ok, soap defaults to listMethods",
+			conf: config.HealthCheckConf{
+				Type:   "soap",
+				Client: common.ClientIdentifierConf{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70009999"},
+				Service: common.ServiceIdentifierConf{
+					XRoadInstance: "ee-test",
+					MemberClass:   "GOV",
+					MemberCode:    "70008899",
+					SubsystemCode: "rr",
+				},
+			},
+			expected: HealthCheck{
+				Type:               HealthCheckSOAP,
+				Interval:           10 * time.Second,
+				Timeout:            5 * time.Second,
+				HealthyThreshold:   1,
+				UnhealthyThreshold: 3,
+				ExpectedStatus:     200,
+				Client:             soap.ClientIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70009999"},
+				Service: soap.ServiceIdentifier{
+					XRoadInstance: "ee-test",
+					MemberClass:   "GOV",
+					MemberCode:    "70008899",
+					SubsystemCode: "rr",
+					ServiceCode:   "listMethods",
+				},
+			},
+		},
+		{
+			name:          "nok, unknown type",
+			conf:          config.HealthCheckConf{Type: "icmp"},
+			expectedError: "invalid health_check type 'icmp', expected 'http', 'tcp' or 'soap'",
+		},
+		{
+			name:          "nok, soap without identifiers",
+			conf:          config.HealthCheckConf{Type: "soap"},
+			expectedError: "soap health_check must have client and service set",
+		},
+		{
+			name:          "nok, negative interval",
+			conf:          config.HealthCheckConf{Type: "tcp", Interval: -1},
+			expectedError: "health_check interval, timeout and thresholds can not be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check, err := convertHealthCheck(tc.conf)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, check)
+		})
+	}
+}
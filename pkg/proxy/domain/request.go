@@ -6,11 +6,21 @@ import "time"
 type Request struct {
 	ID           string
 	RuleID       int64
+	Server       string
+	WeightBucket int
+	Scenario     string
 	Service      string
 	Request      []byte
 	RequestTime  time.Time
 	RequestSize  int64
+	Attempts     []Attempt
 	Response     []byte
 	ResponseTime time.Time
 	ResponseSize int64
+	Error        string
+	Fault        string
+	Shadows      *ShadowResponses
+	// PrimaryResponse is decoded response of server before rule response replacements and injected faults. It is
+	// stored only for requests with shadow servers as shadow responses are compared to it
+	PrimaryResponse []byte
 }
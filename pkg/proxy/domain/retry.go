@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// RetryOnConnect retries requests that failed to connect to server
+	RetryOnConnect = "connect"
+	// RetryOnReset retries requests where server closed or reset connection
+	RetryOnReset = "reset"
+	// RetryOnTimeout retries requests that timed out
+	RetryOnTimeout = "timeout"
+
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+	defaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy describes how failed requests to server are retried
+type RetryPolicy struct {
+	MaxAttempts   int
+	Backoff       time.Duration
+	MaxBackoff    time.Duration
+	Multiplier    float64
+	RetryOnStatus []int
+	RetryOnErrors []string
+}
+
+// Attempt describes single attempt to send request to server
+type Attempt struct {
+	StartTime  time.Time
+	Duration   time.Duration
+	StatusCode int
+	Error      string
+}
+
+// ConvertRetryPolicy converts retry configuration to domain object. Omitted values get defaults
+func ConvertRetryPolicy(conf config.RetryConf) (RetryPolicy, error) {
+	if conf.MaxAttempts < 0 || conf.Backoff < 0 || conf.MaxBackoff < 0 || conf.BackoffMultiplier < 0 {
+		return RetryPolicy{}, errors.New("retry max_attempts, backoff and multiplier can not be negative")
+	}
+	for _, e := range conf.RetryOnErrors {
+		switch e {
+		case RetryOnConnect, RetryOnReset, RetryOnTimeout:
+		default:
+			return RetryPolicy{}, errors.Errorf("invalid retry_on_errors value '%v', expected 'connect', 'reset' or 'timeout'", e)
+		}
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts:   conf.MaxAttempts,
+		Backoff:       conf.Backoff,
+		MaxBackoff:    conf.MaxBackoff,
+		Multiplier:    conf.BackoffMultiplier,
+		RetryOnStatus: conf.RetryOnStatus,
+		RetryOnErrors: conf.RetryOnErrors,
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Backoff == 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaultRetryMultiplier
+	}
+	if len(policy.RetryOnErrors) == 0 {
+		policy.RetryOnErrors = []string{RetryOnConnect, RetryOnReset, RetryOnTimeout}
+	}
+	return policy, nil
+}
+
+// Attempts returns how many times request is tried at most. Zero policy means single attempt
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// BackoffFor returns duration to wait before given retry (1 for first retry). Backoff grows exponentially
+// by multiplier until max backoff is reached
+func (p RetryPolicy) BackoffFor(retry int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// IsRetryableStatus returns true when response with given status code should be retried
+func (p RetryPolicy) IsRetryableStatus(statusCode int) bool {
+	for _, s := range p.RetryOnStatus {
+		if s == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryableError returns true when request that failed with given error should be retried
+func (p RetryPolicy) IsRetryableError(err error) bool {
+	kind := errorKind(err)
+	for _, e := range p.RetryOnErrors {
+		if e == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func errorKind(err error) string {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return RetryOnTimeout
+	}
+	if opErr, ok := err.(*net.OpError); ok && opErr.Op == "dial" {
+		return RetryOnConnect
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return RetryOnReset
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "EOF") || strings.Contains(msg, "connection closed") {
+		return RetryOnReset
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoffFor(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+
+	assert.Equal(t, 100*time.Millisecond, policy.BackoffFor(1))
+	assert.Equal(t, 300*time.Millisecond, policy.BackoffFor(2))
+	assert.Equal(t, 900*time.Millisecond, policy.BackoffFor(3))
+	assert.Equal(t, time.Second, policy.BackoffFor(4))
+	assert.Equal(t, time.Second, policy.BackoffFor(10))
+}
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	policy, err := ConvertRetryPolicy(config.RetryConf{
+		MaxAttempts:   3,
+		RetryOnStatus: []int{502, 503},
+		RetryOnErrors: []string{RetryOnConnect, RetryOnReset},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, policy.Attempts())
+	assert.True(t, policy.IsRetryableStatus(503))
+	assert.False(t, policy.IsRetryableStatus(500))
+	assert.True(t, policy.IsRetryableError(&net.OpError{Op: "dial", Err: io.ErrClosedPipe}))
+	assert.True(t, policy.IsRetryableError(io.EOF))
+	assert.False(t, policy.IsRetryableError(io.ErrShortWrite))
+}
+
+func TestConvertRetryPolicy(t *testing.T) {
+	policy, err := ConvertRetryPolicy(config.RetryConf{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, RetryPolicy{
+		MaxAttempts:   1,
+		Backoff:       100 * time.Millisecond,
+		MaxBackoff:    5 * time.Second,
+		Multiplier:    2,
+		RetryOnErrors: []string{RetryOnConnect, RetryOnReset, RetryOnTimeout},
+	}, policy)
+
+	_, err = ConvertRetryPolicy(config.RetryConf{RetryOnErrors: []string{"dns"}})
+	assert.EqualError(t, err, "invalid retry_on_errors value 'dns', expected 'connect', 'reset' or 'timeout'")
+}
@@ -1,11 +1,21 @@
 package domain
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/schedule"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
 	"github.com/pkg/errors"
+	"hash/fnv"
+	"math/rand"
+	"net"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Rules is collection type for Rule structures
@@ -13,24 +23,59 @@ type Rules []Rule
 
 // Rule describes rules where and when to proxy requests
 type Rule struct {
-	ID                   int64
-	Server               string
-	Service              string
-	Priority             int64
-	MatcherRemoteAddr    []string
-	MatcherRegex         []*regexp.Regexp
+	ID                int64
+	Server            string
+	Servers           WeightedServers
+	StickyBy          string
+	FallbackServers   []string
+	ShadowServers     []string
+	Service           soap.ServiceIdentifier
+	Priority          int64
+	MatcherRemoteAddr remoteaddr.Matcher
+	MatcherRegex      []*regexp.Regexp
+	MatcherXPath      xmldoc.Expressions
+	// MatcherNamespaces are namespace prefixes bound for XPath expressions of MatcherXPath and Matcher
+	MatcherNamespaces xmldoc.Namespaces
+	MatcherHeader     soap.HeaderMatcher
+	Matcher           matcher.Expression
+	Schedule          schedule.Schedule
+	Scenario          string
+	usage.Limit
 	RequestReplacements  Replacements
 	ResponseReplacements Replacements
+	RequestHeaders       HeaderOperations
+	ResponseHeaders      HeaderOperations
+	Faults               Faults
+	Shaping              Shaping
 	IsReadOnly           bool
 }
 
+// WeightedServers is collection type for WeightedServer structures
+type WeightedServers []WeightedServer
+
+// WeightedServer is server with its relative weight of traffic
+type WeightedServer struct {
+	Name   string
+	Weight int
+}
+
+const (
+	// StickyByClient keeps requests from same client subsystem on same server
+	StickyByClient = "client"
+	// StickyByUserID keeps requests with same userId on same server
+	StickyByUserID = "user_id"
+)
+
 // Replacements is collection type for Replacement structures
 type Replacements []Replacement
 
-// Replacement describes rules for replacing things in request/response
+// Replacement describes rules for replacing things in request/response. Either Regex or Rewrite is set. Value can be
+// Go template referencing request data (TemplateData) and is rendered before regex `${1}` expansion. `$` in rendered
+// request data is not expanded
 type Replacement struct {
-	Regex *regexp.Regexp
-	Value string
+	Regex   *regexp.Regexp
+	Value   Template
+	Rewrite *xmldoc.Rewrite
 }
 
 // ConvertRules convert configuration to domain object
@@ -57,6 +102,35 @@ func convertRule(conf config.RuleConf) (Rule, error) {
 		matchers = append(matchers, matcher)
 	}
 
+	xpathMatchers := make(xmldoc.Expressions, 0)
+	for _, m := range conf.MatcherXPath {
+		matcher, err := xmldoc.CompileWithNamespaces(m, conf.MatcherNamespaces)
+		if err != nil {
+			return Rule{}, errors.Wrap(err, "failed to compile matcher XPath")
+		}
+		xpathMatchers = append(xpathMatchers, matcher)
+	}
+
+	service, err := soap.ConvertRuleService(conf.Service, conf.ServiceIdentifier)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	remoteAddrMatcher, err := remoteaddr.Parse(conf.MatcherRemoteAddr)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to parse remote address matcher")
+	}
+
+	expression, err := matcher.FromConf(conf.Matcher, conf.MatcherNamespaces)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert matcher expression")
+	}
+
+	activeSchedule, err := schedule.Parse(conf.ActiveFrom, conf.ActiveUntil, conf.ActiveWindows)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule schedule")
+	}
+
 	requestReplacements, err := convertReplacements(conf.RequestReplacements)
 	if err != nil {
 		return Rule{}, err
@@ -66,6 +140,38 @@ func convertRule(conf config.RuleConf) (Rule, error) {
 		return Rule{}, err
 	}
 
+	servers := make(WeightedServers, len(conf.Servers))
+	for i, s := range conf.Servers {
+		servers[i] = WeightedServer{Name: strings.ToLower(s.Name), Weight: s.Weight}
+	}
+	if err := ValidateServers(conf.Server, servers, conf.StickyBy); err != nil {
+		return Rule{}, err
+	}
+
+	limit, err := usage.New(conf.MaxMatches, conf.TTL)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	requestHeaders, err := ConvertHeaderOperations(conf.RequestHeaders)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule request headers")
+	}
+	responseHeaders, err := ConvertHeaderOperations(conf.ResponseHeaders)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule response headers")
+	}
+
+	faults, err := ConvertFaults(conf.Faults)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule faults")
+	}
+
+	shaping, err := ConvertShaping(conf.Shaping)
+	if err != nil {
+		return Rule{}, errors.Wrap(err, "failed to convert rule shaping")
+	}
+
 	isReadOnly := true
 	if conf.IsReadOnly != nil {
 		isReadOnly = *conf.IsReadOnly
@@ -73,12 +179,27 @@ func convertRule(conf config.RuleConf) (Rule, error) {
 
 	return Rule{
 		Server:               strings.ToLower(conf.Server),
-		Service:              conf.Service,
+		Servers:              servers,
+		StickyBy:             conf.StickyBy,
+		FallbackServers:      NormalizeServerNames(conf.FallbackServers),
+		ShadowServers:        NormalizeServerNames(conf.ShadowServers),
+		Service:              service,
 		Priority:             conf.Priority,
-		MatcherRemoteAddr:    conf.MatcherRemoteAddr,
+		MatcherRemoteAddr:    remoteAddrMatcher,
 		MatcherRegex:         matchers,
+		MatcherXPath:         xpathMatchers,
+		MatcherNamespaces:    conf.MatcherNamespaces,
+		MatcherHeader:        matcher.HeaderFromConf(conf.MatcherHeader),
+		Matcher:              expression,
+		Schedule:             activeSchedule,
+		Scenario:             conf.Scenario,
+		Limit:                limit,
 		RequestReplacements:  requestReplacements,
 		ResponseReplacements: responseReplacements,
+		RequestHeaders:       requestHeaders,
+		ResponseHeaders:      responseHeaders,
+		Faults:               faults,
+		Shaping:              shaping,
 		IsReadOnly:           isReadOnly,
 	}, nil
 }
@@ -96,44 +217,176 @@ func convertReplacements(conf config.ReplacementConfigs) (Replacements, error) {
 }
 
 func convertReplacement(conf config.ReplacementConf) (Replacement, error) {
-	r, err := regexp.Compile(conf.Regex)
+	return NewReplacement(conf.Regex, conf.Value, conf.XPath, conf.Operation, conf.Prefix)
+}
+
+// NewReplacement creates regex replacement or XPath rewrite when xpath or operation is set
+func NewReplacement(regex string, value string, xpath string, operation string, prefix string) (Replacement, error) {
+	t, err := NewTemplate(value)
+	if err != nil {
+		return Replacement{}, errors.Wrap(err, "failed to create replacement value")
+	}
+
+	if xpath != "" || operation != "" {
+		if regex != "" {
+			return Replacement{}, errors.New("replacement regex and xpath can not be both set")
+		}
+		rewrite, err := xmldoc.NewRewrite(operation, xpath, value, prefix)
+		if err != nil {
+			return Replacement{}, errors.Wrap(err, "failed to create replacement rewrite")
+		}
+		return Replacement{Value: t, Rewrite: &rewrite}, nil
+	}
+
+	r, err := regexp.Compile(regex)
 	if err != nil {
 		return Replacement{}, errors.Wrap(err, "failed to compile replacement regexp")
 	}
 
 	return Replacement{
 		Regex: r,
-		Value: conf.Value,
+		Value: t,
 	}, nil
 }
 
-// MatchRemoteAddr returns slice of Rules matching given remote addr
-func (r Rules) MatchRemoteAddr(remoteAddr string) Rules {
+// ValidateServers checks that rule has either single server or valid weighted list of servers
+func ValidateServers(server string, servers WeightedServers, stickyBy string) error {
+	if server == "" && len(servers) == 0 {
+		return errors.New("server or servers must be set")
+	}
+	if server != "" && len(servers) != 0 {
+		return errors.New("server and servers can not be both set")
+	}
+
+	totalWeight := 0
+	for _, s := range servers {
+		if s.Name == "" {
+			return errors.New("weighted server name can not be empty")
+		}
+		if s.Weight < 0 {
+			return errors.Errorf("weighted server '%v' weight can not be negative", s.Name)
+		}
+		totalWeight += s.Weight
+	}
+	if len(servers) != 0 && totalWeight == 0 {
+		return errors.New("sum of weighted server weights must be larger than 0")
+	}
+
+	switch stickyBy {
+	case "", StickyByClient, StickyByUserID:
+		return nil
+	default:
+		return errors.Errorf("invalid sticky_by value '%v', expected '%v' or '%v'", stickyBy, StickyByClient, StickyByUserID)
+	}
+}
+
+// SelectServer selects server name where request with given header is proxied to. Returned bucket is position
+// in range of cumulative weights [0, sum(weights)) that selected server. For single server rules bucket is always 0
+func (r Rule) SelectServer(header soap.Header) (string, int) {
+	if len(r.Servers) == 0 {
+		return r.Server, 0
+	}
+
+	totalWeight := 0
+	for _, s := range r.Servers {
+		totalWeight += s.Weight
+	}
+
+	var bucket int
+	if key := r.stickyKey(header); key != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		bucket = int(h.Sum32() % uint32(totalWeight))
+	} else {
+		bucket = rand.Intn(totalWeight)
+	}
+	return r.Servers.forBucket(bucket), bucket
+}
+
+func (r Rule) stickyKey(header soap.Header) string {
+	switch r.StickyBy {
+	case StickyByClient:
+		if header.Client.IsEmpty() {
+			// request without client falls back to random selection instead of sharing one bucket
+			return ""
+		}
+		return header.Client.String()
+	case StickyByUserID:
+		return header.UserID
+	}
+	return ""
+}
+
+func (s WeightedServers) forBucket(bucket int) string {
+	for _, server := range s {
+		if bucket < server.Weight {
+			return server.Name
+		}
+		bucket -= server.Weight
+	}
+	return s[len(s)-1].Name
+}
+
+// MatchScenario returns slice of Rules bound to given test scenario. Empty scenario returns shared default rules
+func (r Rules) MatchScenario(scenario string) Rules {
 	result := make(Rules, 0)
 	for _, rule := range r {
-		if rule.matchRemoteAddr(remoteAddr) {
+		if rule.Scenario == scenario {
 			result = append(result, rule)
 		}
 	}
 	return result
 }
 
-// MatchService returns slice of Rules matching given service name
-func (r Rules) MatchService(service string) Rules {
+// MatchActive returns slice of Rules that are active at given time
+func (r Rules) MatchActive(now time.Time) Rules {
 	result := make(Rules, 0)
 	for _, rule := range r {
-		if rule.Service == service {
+		if rule.Schedule.IsActive(now) {
 			result = append(result, rule)
 		}
 	}
 	return result
 }
 
-// MatchRegex returns first rule matching its regex
-func (r Rules) MatchRegex(requestBody []byte) (Rule, bool) {
+// MatchRemoteAddr returns slice of Rules matching given client IP address
+func (r Rules) MatchRemoteAddr(clientIP net.IP) Rules {
+	result := make(Rules, 0)
+	for _, rule := range r {
+		if rule.matchRemoteAddr(clientIP) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// MatchService returns slice of Rules matching given service identifier
+func (r Rules) MatchService(service soap.ServiceIdentifier) Rules {
+	result := make(Rules, 0)
+	for _, rule := range r {
+		if rule.Service.Match(service) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// MatchHeader returns slice of Rules matching given X-road SOAP header
+func (r Rules) MatchHeader(header soap.Header) Rules {
+	result := make(Rules, 0)
+	for _, rule := range r {
+		if rule.MatcherHeader.Match(header) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// MatchRequest returns first rule (in priority order) matching its regex, XPath and matcher expression
+func (r Rules) MatchRequest(request matcher.Request) (Rule, bool) {
 	sort.Sort(byPriorityDesc(r))
 	for _, rule := range r {
-		if rule.match(requestBody) {
+		if rule.match(request) {
 			return rule, true
 		}
 	}
@@ -150,7 +403,13 @@ func (r Rules) FindByID(ID int64) (Rule, bool) {
 	return Rule{}, false
 }
 
-func (r Rule) match(requestBody []byte) bool {
+func (r Rule) match(request matcher.Request) bool {
+	return r.matchRegex(request.Body) &&
+		r.matchXPath(request.Document) &&
+		r.Matcher.Match(request)
+}
+
+func (r Rule) matchRegex(requestBody []byte) bool {
 	if len(r.MatcherRegex) == 0 {
 		return true
 	}
@@ -163,37 +422,80 @@ func (r Rule) match(requestBody []byte) bool {
 	return false
 }
 
-func (r Rule) matchRemoteAddr(remoteAddr string) bool {
+func (r Rule) matchXPath(doc *xmldoc.Document) bool {
+	if len(r.MatcherXPath) == 0 {
+		return true
+	}
+	return r.MatcherXPath.MatchAny(doc)
+}
+
+func (r Rule) matchRemoteAddr(clientIP net.IP) bool {
 	if len(r.MatcherRemoteAddr) == 0 {
 		return true
 	}
-	for _, remote := range r.MatcherRemoteAddr {
-		if strings.HasPrefix(remoteAddr, remote) {
-			return true
+	return r.MatcherRemoteAddr.Contains(clientIP)
+}
+
+// Captures returns capture groups of first matcher regex matching request body. Named groups are also returned by
+// their names
+func (r Rule) Captures(requestBody []byte) ([]string, map[string]string) {
+	for _, regex := range r.MatcherRegex {
+		match := regex.FindSubmatch(requestBody)
+		if match == nil {
+			continue
 		}
+		captures := make([]string, len(match))
+		named := map[string]string{}
+		for i, m := range match {
+			captures[i] = string(m)
+			if name := regex.SubexpNames()[i]; name != "" {
+				named[name] = string(m)
+			}
+		}
+		return captures, named
 	}
-	return false
+	return nil, map[string]string{}
 }
 
-// ApplyRequestReplacements applies rule request replacements on body
-func (r Rule) ApplyRequestReplacements(body []byte) []byte {
-	return applyReplacements(body, r.RequestReplacements)
+// ApplyRequestReplacements applies rule request replacements on body. Replacements with values failing to render are
+// skipped and their errors returned
+func (r Rule) ApplyRequestReplacements(body []byte, data TemplateData) ([]byte, []error) {
+	return applyReplacements(body, r.RequestReplacements, data)
 }
 
-// ApplyResponseReplacements applies rule response replacements on body
-func (r Rule) ApplyResponseReplacements(body []byte) []byte {
-	return applyReplacements(body, r.ResponseReplacements)
+// ApplyResponseReplacements applies rule response replacements on body. Replacements with values failing to render
+// are skipped and their errors returned
+func (r Rule) ApplyResponseReplacements(body []byte, data TemplateData) ([]byte, []error) {
+	return applyReplacements(body, r.ResponseReplacements, data)
 }
 
-func applyReplacements(body []byte, replacements Replacements) []byte {
+func applyReplacements(body []byte, replacements Replacements, data TemplateData) ([]byte, []error) {
 	result := make([]byte, len(body))
 	copy(result, body)
 
+	var errs []error
 	for _, r := range replacements {
-		result = r.Regex.ReplaceAll(result, []byte(r.Value))
+		if r.Rewrite != nil {
+			value, err := r.Value.Render(data)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			rewrite := *r.Rewrite
+			rewrite.Value = value
+			// body that is not XML or fails to rewrite is left as is
+			result, _ = rewrite.Apply(result)
+			continue
+		}
+		value, err := r.Value.RenderRegexReplacement(data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result = r.Regex.ReplaceAll(result, []byte(value))
 	}
 
-	return result
+	return result, errs
 }
 
 type byPriorityDesc Rules
@@ -204,7 +506,13 @@ func (s byPriorityDesc) Less(i, j int) bool {
 	iPriority := s[i].Priority
 	jPriority := s[j].Priority
 	if iPriority == jPriority {
-		return s[i].ID > s[j].ID
+		// with equal priorities more specific service (exact match over wildcard) wins
+		iSpecificity := s[i].Service.Specificity()
+		jSpecificity := s[j].Service.Specificity()
+		if iSpecificity == jSpecificity {
+			return s[i].ID > s[j].ID
+		}
+		return iSpecificity > jSpecificity
 	}
 	return iPriority > jPriority
 }
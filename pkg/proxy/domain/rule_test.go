@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRuleSelectServer(t *testing.T) {
+	rule := Rule{Server: "real-xroad"}
+
+	server, bucket := rule.SelectServer(soap.Header{})
+
+	assert.Equal(t, "real-xroad", server)
+	assert.Equal(t, 0, bucket)
+}
+
+func TestRuleSelectServerByWeight(t *testing.T) {
+	rule := Rule{
+		Servers: WeightedServers{
+			{Name: "real-xroad", Weight: 0},
+			{Name: "dev-xroad", Weight: 10},
+		},
+	}
+
+	for i := 0; i < 20; i++ {
+		server, bucket := rule.SelectServer(soap.Header{})
+
+		assert.Equal(t, "dev-xroad", server)
+		assert.True(t, bucket >= 0 && bucket < 10)
+	}
+}
+
+func TestRuleSelectServerSticky(t *testing.T) {
+	rule := Rule{
+		Servers: WeightedServers{
+			{Name: "real-xroad", Weight: 90},
+			{Name: "dev-xroad", Weight: 10},
+		},
+		StickyBy: StickyByUserID,
+	}
+	header := soap.Header{UserID: "EE11111111111"}
+
+	server, bucket := rule.SelectServer(header)
+	for i := 0; i < 20; i++ {
+		s, b := rule.SelectServer(header)
+
+		assert.Equal(t, server, s)
+		assert.Equal(t, bucket, b)
+	}
+}
+
+func TestRuleSelectServerStickyWithoutClient(t *testing.T) {
+	rule := Rule{
+		Servers: WeightedServers{
+			{Name: "real-xroad", Weight: 50},
+			{Name: "dev-xroad", Weight: 50},
+		},
+		StickyBy: StickyByClient,
+	}
+
+	buckets := map[int]bool{}
+	for i := 0; i < 50; i++ {
+		_, bucket := rule.SelectServer(soap.Header{})
+		buckets[bucket] = true
+	}
+
+	assert.True(t, len(buckets) > 1)
+}
+
+func TestValidateServers(t *testing.T) {
+	var testCases = []struct {
+		name          string
+		server        string
+		servers       WeightedServers
+		stickyBy      string
+		expectedError string
+	}{
+		{
+			name:   "ok, single server",
+			server: "real-xroad",
+		},
+		{
+			name:     "ok, weighted servers",
+			servers:  WeightedServers{{Name: "real-xroad", Weight: 90}, {Name: "dev-xroad", Weight: 10}},
+			stickyBy: StickyByClient,
+		},
+		{
+			name:          "nok, no servers",
+			expectedError: "server or servers must be set",
+		},
+		{
+			name:          "nok, both set",
+			server:        "real-xroad",
+			servers:       WeightedServers{{Name: "dev-xroad", Weight: 10}},
+			expectedError: "server and servers can not be both set",
+		},
+		{
+			name:          "nok, zero total weight",
+			servers:       WeightedServers{{Name: "dev-xroad", Weight: 0}},
+			expectedError: "sum of weighted server weights must be larger than 0",
+		},
+		{
+			name:          "nok, invalid sticky_by",
+			servers:       WeightedServers{{Name: "dev-xroad", Weight: 1}},
+			stickyBy:      "session",
+			expectedError: "invalid sticky_by value 'session', expected 'client' or 'user_id'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateServers(tc.server, tc.servers, tc.stickyBy)
+
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRuleApplyResponseReplacements(t *testing.T) {
+	rules, err := ConvertRules(config.RuleConfigs{{
+		Server:  "real-xroad",
+		Service: "rr.RR456.v1",
+		ResponseReplacements: config.ReplacementConfigs{
+			{XPath: "//Isik/@id", Value: "9"},
+			{Regex: `<Nimi>\w+</Nimi>`, Value: "<Nimi>Jaan</Nimi>"},
+			{XPath: "//Isik", Operation: "insert", Value: "<Staatus>elus</Staatus>"},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, errs := rules[0].ApplyResponseReplacements([]byte(`<r><Isik nr="1" id="1"><Nimi>Mari</Nimi></Isik></r>`), TemplateData{})
+
+	assert.Empty(t, errs)
+	assert.Equal(t, `<r><Isik nr="1" id="9"><Nimi>Jaan</Nimi><Staatus>elus</Staatus></Isik></r>`, string(result))
+}
+
+func TestRuleApplyTemplatedReplacements(t *testing.T) {
+	rules, err := ConvertRules(config.RuleConfigs{{
+		Server:       "real-xroad",
+		Service:      "rr.RR456.v1",
+		MatcherRegex: []string{`<Isikukood>(?P<code>\d+)</Isikukood>`},
+		ResponseReplacements: config.ReplacementConfigs{
+			{XPath: "//id", Value: "{{ .Header.ID }}"},
+			{Regex: `<Server>(\w+)</Server>`, Value: "<Server>${1}-{{ .Server }}</Server>"},
+			{Regex: `<Kasutaja>\w+</Kasutaja>`, Value: "<Kasutaja>{{ xml .Header.UserID }}</Kasutaja>"},
+			{XPath: "//Isik", Operation: "insert", Value: "<Kood>{{ .NamedCaptures.code }}</Kood>"},
+			{Regex: `<Nimi>`, Value: "{{ .Missing }}"},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rules[0]
+
+	captures, named := rule.Captures([]byte(`<r><Isikukood>38001010000</Isikukood></r>`))
+	assert.Equal(t, []string{"<Isikukood>38001010000</Isikukood>", "38001010000"}, captures)
+	assert.Equal(t, map[string]string{"code": "38001010000"}, named)
+
+	data := TemplateData{
+		Server:        "real-xroad",
+		Header:        soap.Header{ID: "abc-123", UserID: "EE$1<&>"},
+		Captures:      captures,
+		NamedCaptures: named,
+	}
+	result, errs := rule.ApplyResponseReplacements([]byte(`<r><id>1</id><Server>mock</Server><Kasutaja>EE1</Kasutaja><Isik><Nimi>Mari</Nimi></Isik></r>`), data)
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, `<r><id>abc-123</id><Server>mock-real-xroad</Server><Kasutaja>EE$1&lt;&amp;&gt;</Kasutaja><Isik><Nimi>Mari</Nimi><Kood>38001010000</Kood></Isik></r>`, string(result))
+}
+
+func TestConvertReplacementInvalid(t *testing.T) {
+	_, err := NewReplacement("<a>", "", "//a", "", "")
+
+	assert.EqualError(t, err, "replacement regex and xpath can not be both set")
+}
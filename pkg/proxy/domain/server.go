@@ -10,7 +10,6 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 )
 
 // ProxyServers is collections type for ProxyServer instances
@@ -18,12 +17,20 @@ type ProxyServers []ProxyServer
 
 // ProxyServer is proxy server where request can be proxied
 type ProxyServer struct {
-	ID         int64
-	Name       string
-	Address    url.URL
-	IsDefault  bool
-	IsReadOnly bool
-	Transport  http.RoundTripper
+	ID                int64
+	Name              string
+	Address           url.URL
+	IsDefault         bool
+	IsReadOnly        bool
+	Transport         http.RoundTripper
+	TransportSettings TransportSettings
+	HealthCheck       HealthCheck
+	Endpoints         *EndpointPool
+	FallbackServers   []string
+	Retry             RetryPolicy
+	Breaker           *CircuitBreaker
+	Shaping           Shaping
+	Translations      Translations
 }
 
 // ConvertProxyServers converts configuration to domain object
@@ -45,19 +52,33 @@ func ConvertProxyServers(conf config.ProxyServerConfigs) (ProxyServers, error) {
 }
 
 func createProxyServer(conf config.ProxyServerConf) (ProxyServer, error) {
-	var transport = http.DefaultTransport
+	settings, err := ConvertTransportSettings(conf.Transport)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid transport for server '%v'", conf.Name)
+	}
+	outbound := conf.OutboundProxy
+	settings.Proxy, err = NewOutboundProxy(outbound.URL, outbound.Username, outbound.Password, outbound.NoProxy)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid outbound proxy for server '%v'", conf.Name)
+	}
 
+	// transport is always built from settings so omitted and all-default transport configuration behave the same
+	var tlsClientConf *tls.Config
 	if !conf.TLS.UseSystemTransport && conf.TLS.CertFile != "" {
-		tlsClientConf, err := confToTLSConfig(conf.TLS)
+		tlsClientConf, err = confToTLSConfig(conf.TLS)
 		if err != nil {
 			return ProxyServer{}, err
 		}
-		transport = ProxyServerTransport(tlsClientConf)
 	}
+	transport := ProxyServerTransport(tlsClientConf, settings)
 
-	address, err := url.Parse(conf.Address)
+	addresses, err := ParseAddresses(conf.Address, conf.Endpoints)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid address for server '%v'", conf.Name)
+	}
+	endpoints, err := NewEndpointPool(conf.LoadBalancing, addresses)
 	if err != nil {
-		return ProxyServer{}, errors.Wrap(err, "failed to parse proxy server address to url")
+		return ProxyServer{}, errors.Wrapf(err, "invalid endpoints for server '%v'", conf.Name)
 	}
 
 	isReadOnly := true
@@ -65,23 +86,91 @@ func createProxyServer(conf config.ProxyServerConf) (ProxyServer, error) {
 		isReadOnly = *conf.IsReadOnly
 	}
 
+	healthCheck, err := convertHealthCheck(conf.HealthCheck)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid health check for server '%v'", conf.Name)
+	}
+
+	retry, err := ConvertRetryPolicy(conf.Retry)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid retry policy for server '%v'", conf.Name)
+	}
+
+	breaker, err := ConvertCircuitBreaker(conf.CircuitBreaker)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid circuit breaker for server '%v'", conf.Name)
+	}
+
+	shaping, err := ConvertShaping(conf.Shaping)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid shaping for server '%v'", conf.Name)
+	}
+
+	translations, err := ConvertTranslations(conf.Translations)
+	if err != nil {
+		return ProxyServer{}, errors.Wrapf(err, "invalid translations for server '%v'", conf.Name)
+	}
+
 	return ProxyServer{
-		Name:       strings.ToLower(conf.Name),
-		Address:    *address,
-		IsDefault:  conf.IsDefault,
-		IsReadOnly: isReadOnly,
-		Transport:  transport,
+		Name:              strings.ToLower(conf.Name),
+		Address:           addresses[0],
+		IsDefault:         conf.IsDefault,
+		IsReadOnly:        isReadOnly,
+		Transport:         transport,
+		TransportSettings: settings,
+		HealthCheck:       healthCheck,
+		Endpoints:         endpoints,
+		FallbackServers:   NormalizeServerNames(conf.FallbackServers),
+		Retry:             retry,
+		Breaker:           breaker,
+		Shaping:           shaping,
+		Translations:      translations,
 	}, nil
 }
 
-// ProxyServerTransport creates proxy server transport for default settings
-func ProxyServerTransport(tlsClientConf *tls.Config) *http.Transport {
-	return &http.Transport{
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig:     tlsClientConf,
-		MaxIdleConns:        100,
-		MaxConnsPerHost:     25, // we should usually have very few different clients connecting
+// ParseAddresses parses server address or list of its endpoint addresses to urls
+func ParseAddresses(address string, endpoints []string) ([]url.URL, error) {
+	if address != "" && len(endpoints) > 0 {
+		return nil, errors.New("address and endpoints can not be both set")
+	}
+	if len(endpoints) == 0 {
+		endpoints = []string{address}
+	}
+
+	result := make([]url.URL, len(endpoints))
+	for i, e := range endpoints {
+		parsed, err := url.Parse(e)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse proxy server address to url")
+		}
+		result[i] = *parsed
+	}
+	return result, nil
+}
+
+// IsHealthy returns true when any of server endpoints is healthy
+func (s ProxyServer) IsHealthy() bool {
+	return s.Endpoints.IsHealthy()
+}
+
+// SelectAddress returns address of endpoint where next request to server is sent
+func (s ProxyServer) SelectAddress() url.URL {
+	if e := s.Endpoints.Select(); e != nil {
+		return e.Address
+	}
+	return s.Address
+}
+
+// NormalizeServerNames converts server names to form they are looked up with
+func NormalizeServerNames(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = strings.ToLower(v)
 	}
+	return result
 }
 
 func confToTLSConfig(config common.TLSConf) (*tls.Config, error) {
@@ -125,13 +214,26 @@ func (p ProxyServers) Find(name string) (ProxyServer, bool) {
 	return ProxyServer{}, false
 }
 
-// FindByHost returns first proxy server matching given host
+// FindHealthy returns first healthy proxy server from given names
+func (p ProxyServers) FindHealthy(names []string) (ProxyServer, bool) {
+	for _, name := range names {
+		if s, ok := p.Find(name); ok && s.IsHealthy() {
+			return s, true
+		}
+	}
+	return ProxyServer{}, false
+}
+
+// FindByHost returns first proxy server matching given host (of its address or any of its endpoints)
 func (p ProxyServers) FindByHost(host string) (ProxyServer, bool) {
 	for _, s := range p {
 		// NB: Address.Host contains already port. ie. 'localhost:443'
 		if s.Address.Host == host {
 			return s, true
 		}
+		if _, ok := s.Endpoints.FindByHost(host); ok {
+			return s, true
+		}
 	}
 	return ProxyServer{}, false
 }
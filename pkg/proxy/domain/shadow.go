@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldiff"
+	"sync"
+	"time"
+)
+
+// ShadowResponses holds responses of shadow servers request was mirrored to. Responses arrive asynchronously
+// so access is guarded by mutex and same instance is shared between copies of cached request
+type ShadowResponses struct {
+	mutex     sync.RWMutex
+	primary   []byte
+	responses []ShadowResponse
+}
+
+// ShadowResponse is response of shadow server to mirrored request
+type ShadowResponse struct {
+	Server       string
+	Done         bool
+	StatusCode   int
+	Response     []byte
+	ResponseTime time.Time
+	Duration     time.Duration
+	Error        string
+	// Differences from primary response. Computed once both responses have arrived
+	Differences []xmldiff.Difference
+}
+
+// NewShadowResponses creates pending shadow responses for given servers
+func NewShadowResponses(servers []string) *ShadowResponses {
+	responses := make([]ShadowResponse, len(servers))
+	for i, s := range servers {
+		responses[i] = ShadowResponse{Server: s}
+	}
+	return &ShadowResponses{responses: responses}
+}
+
+// Set stores response of shadow server at given index and compares it to primary response when it has arrived
+func (s *ShadowResponses) Set(index int, response ShadowResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	response.Done = true
+	if s.primary != nil {
+		response.Differences = xmldiff.Compare(s.primary, response.Response)
+	}
+	s.responses[index] = response
+}
+
+// SetPrimary stores primary response and compares it to shadow responses that have already arrived
+func (s *ShadowResponses) SetPrimary(primary []byte) {
+	if s == nil || primary == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.primary = primary
+	for i, r := range s.responses {
+		if r.Done {
+			s.responses[i].Differences = xmldiff.Compare(primary, r.Response)
+		}
+	}
+}
+
+// All returns copy of shadow responses
+func (s *ShadowResponses) All() []ShadowResponse {
+	if s == nil {
+		return nil
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]ShadowResponse{}, s.responses...)
+}
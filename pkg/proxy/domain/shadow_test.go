@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShadowResponsesDifferences(t *testing.T) {
+	primary := []byte(`<r><a>1</a></r>`)
+
+	shadows := NewShadowResponses([]string{"before", "after"})
+	shadows.Set(0, ShadowResponse{Server: "before", Response: []byte(`<r><a>2</a></r>`)})
+	assert.Empty(t, shadows.All()[0].Differences)
+
+	shadows.SetPrimary(primary)
+	shadows.Set(1, ShadowResponse{Server: "after", Response: []byte(`<r><a>1</a><b/></r>`)})
+
+	all := shadows.All()
+	assert.Len(t, all[0].Differences, 1)
+	assert.Len(t, all[1].Differences, 1)
+}
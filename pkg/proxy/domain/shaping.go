@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Shaping describes latency and bandwidth limits simulating slow network link
+type Shaping struct {
+	Latency                time.Duration
+	Jitter                 time.Duration
+	RequestBytesPerSecond  int64
+	ResponseBytesPerSecond int64
+}
+
+// ConvertShaping converts shaping configuration to domain object
+func ConvertShaping(conf config.ShapingConf) (Shaping, error) {
+	if conf.Latency < 0 || conf.Jitter < 0 {
+		return Shaping{}, errors.New("shaping latency and jitter can not be negative")
+	}
+	if conf.RequestBytesPerSecond < 0 || conf.ResponseBytesPerSecond < 0 {
+		return Shaping{}, errors.New("shaping bytes per second limits can not be negative")
+	}
+	return Shaping{
+		Latency:                conf.Latency,
+		Jitter:                 conf.Jitter,
+		RequestBytesPerSecond:  conf.RequestBytesPerSecond,
+		ResponseBytesPerSecond: conf.ResponseBytesPerSecond,
+	}, nil
+}
+
+// IsEmpty returns true when traffic is not shaped
+func (s Shaping) IsEmpty() bool {
+	return s == Shaping{}
+}
+
+// Override returns shaping where set (non zero) values of given shaping replace values of this shaping
+func (s Shaping) Override(o Shaping) Shaping {
+	if o.Latency > 0 {
+		s.Latency = o.Latency
+	}
+	if o.Jitter > 0 {
+		s.Jitter = o.Jitter
+	}
+	if o.RequestBytesPerSecond > 0 {
+		s.RequestBytesPerSecond = o.RequestBytesPerSecond
+	}
+	if o.ResponseBytesPerSecond > 0 {
+		s.ResponseBytesPerSecond = o.ResponseBytesPerSecond
+	}
+	return s
+}
+
+// Delay returns latency with random jitter added. random returns values in [0.0, 1.0) (for example rand.Float64)
+func (s Shaping) Delay(random func() float64) time.Duration {
+	if s.Jitter == 0 {
+		return s.Latency
+	}
+	return s.Latency + time.Duration(random()*float64(s.Jitter))
+}
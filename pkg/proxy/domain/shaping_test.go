@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestShapingOverride(t *testing.T) {
+	server := Shaping{Latency: time.Second, Jitter: 100 * time.Millisecond, ResponseBytesPerSecond: 1024}
+	rule := Shaping{Latency: 2 * time.Second, RequestBytesPerSecond: 512}
+
+	result := server.Override(rule)
+
+	assert.Equal(t, Shaping{
+		Latency:                2 * time.Second,
+		Jitter:                 100 * time.Millisecond,
+		RequestBytesPerSecond:  512,
+		ResponseBytesPerSecond: 1024,
+	}, result)
+}
+
+func TestShapingDelay(t *testing.T) {
+	shaping := Shaping{Latency: time.Second, Jitter: 200 * time.Millisecond}
+
+	assert.Equal(t, 1100*time.Millisecond, shaping.Delay(func() float64 { return 0.5 }))
+	assert.Equal(t, time.Second, Shaping{Latency: time.Second}.Delay(nil))
+}
+
+func TestConvertShapingInvalid(t *testing.T) {
+	_, err := ConvertShaping(config.ShapingConf{Jitter: -time.Second})
+	assert.EqualError(t, err, "shaping latency and jitter can not be negative")
+
+	_, err = ConvertShaping(config.ShapingConf{ResponseBytesPerSecond: -1})
+	assert.EqualError(t, err, "shaping bytes per second limits can not be negative")
+}
@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/pkg/errors"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// TemplateData is data of proxied request available to templated values. For example `{{ .Header.Client.MemberCode }}`,
+// `{{ .Server }}` or `{{ index .Captures 1 }}`. Values inserted into XML should be escaped with `xml` function, for
+// example `{{ xml .Header.UserID }}`
+type TemplateData struct {
+	RequestID string
+	RuleID    int64
+	Server    string
+	Scenario  string
+	Service   string
+	ClientIP  string
+	// Header is X-road SOAP header of request
+	Header soap.Header
+	// Captures are capture groups of rule matcher regex that matched request body. Index 0 is whole match
+	Captures []string
+	// NamedCaptures are named capture groups of rule matcher regex that matched request body
+	NamedCaptures map[string]string
+	Now           time.Time
+}
+
+// escapeDollarFunc is name of function appended to template actions when value is used as regex replacement
+const escapeDollarFunc = "escapeDollar"
+
+// templateFuncs are functions available to templated values
+var templateFuncs = template.FuncMap{
+	"xml":            soap.EscapeXML,
+	escapeDollarFunc: escapeDollar,
+}
+
+// Template is value that is rendered as Go template when it contains template actions and used as is otherwise.
+// Literal `{{` in templated value can be written as `{{ "{{" }}`
+type Template struct {
+	source   string
+	template *template.Template
+	// regexTemplate is template with `$` escaped in output of its actions so that only `$1` and `${name}` written
+	// in template source are expanded by regex replacement
+	regexTemplate *template.Template
+}
+
+// NewTemplate parses value as Go template when it contains template actions
+func NewTemplate(value string) (Template, error) {
+	if !strings.Contains(value, "{{") {
+		return Template{source: value}, nil
+	}
+	t, err := parseTemplate(value)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "failed to parse value template '%v'", value)
+	}
+	// parse trees are shared between clones so regex template is parsed separately before its actions are modified
+	regexTemplate, err := parseTemplate(value)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "failed to parse value template '%v'", value)
+	}
+	for _, tmpl := range regexTemplate.Templates() {
+		escapeActions(tmpl.Tree, tmpl.Tree.Root)
+	}
+	return Template{source: value, template: t, regexTemplate: regexTemplate}, nil
+}
+
+func parseTemplate(value string) (*template.Template, error) {
+	return template.New("value").Funcs(templateFuncs).Option("missingkey=error").Parse(value)
+}
+
+// escapeActions appends escapeDollar function to pipelines of actions that output value
+func escapeActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			escape := &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(escapeDollarFunc).SetTree(tree).SetPos(n.Pos)},
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, escape)
+		}
+	case *parse.IfNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	}
+}
+
+func escapeDollar(value interface{}) string {
+	return strings.Replace(fmt.Sprint(value), "$", "$$", -1)
+}
+
+// String returns source of template
+func (t Template) String() string {
+	return t.source
+}
+
+// IsTemplate returns true when value contains template actions
+func (t Template) IsTemplate() bool {
+	return t.template != nil
+}
+
+// Render renders template with given data. Source of template is returned when rendering fails
+func (t Template) Render(data TemplateData) (string, error) {
+	return t.render(t.template, data)
+}
+
+// RenderRegexReplacement renders template for regex replacement. `$` in rendered request data is escaped as `$$` so
+// that only `$1` and `${name}` written in template source are expanded by regex replacement
+func (t Template) RenderRegexReplacement(data TemplateData) (string, error) {
+	return t.render(t.regexTemplate, data)
+}
+
+func (t Template) render(tmpl *template.Template, data TemplateData) (string, error) {
+	if tmpl == nil {
+		return t.source, nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return t.source, errors.Wrapf(err, "failed to render value template '%v'", t.source)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,148 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldoc"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/antchfx/xmlquery"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// identifierParts are local names of X-road identifier elements in order they are used in translation prefixes
+var identifierParts = []string{"xRoadInstance", "memberClass", "memberCode", "subsystemCode"}
+
+// headerIdentifiers selects client and service identifier elements of SOAP header regardless of namespace prefixes
+const headerIdentifiers = "/*[local-name()='Envelope']/*[local-name()='Header']/*[local-name()='client' or local-name()='service']"
+
+// Translations is collection type for Translation structures. Translations are ordered so that longer (more
+// specific) prefixes are tried first
+type Translations []Translation
+
+// Translation replaces X-road identifier prefix (instance, member class, member code, subsystem code) with another
+type Translation struct {
+	From []string
+	To   []string
+}
+
+// ConvertTranslations converts translation configuration to domain objects
+func ConvertTranslations(conf config.TranslationConfigs) (Translations, error) {
+	result := Translations{}
+	for _, c := range conf {
+		t, err := NewTranslation(c.From, c.To)
+		if err != nil {
+			return Translations{}, err
+		}
+		result = append(result, t)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return len(result[i].From) > len(result[j].From)
+	})
+	return result, nil
+}
+
+// NewTranslation creates translation from identifier prefixes like `ee-test/GOV` and `ee-dev/GOV`
+func NewTranslation(from string, to string) (Translation, error) {
+	fromParts := strings.Split(from, "/")
+	toParts := strings.Split(to, "/")
+	if len(fromParts) != len(toParts) {
+		return Translation{}, errors.Errorf("translation '%v' and '%v' must have same number of identifier parts", from, to)
+	}
+	if len(fromParts) > len(identifierParts) {
+		return Translation{}, errors.Errorf("translation '%v' has too many identifier parts", from)
+	}
+	for i := range fromParts {
+		if fromParts[i] == "" || toParts[i] == "" {
+			return Translation{}, errors.Errorf("translation '%v' to '%v' has empty identifier part", from, to)
+		}
+	}
+	return Translation{From: fromParts, To: toParts}, nil
+}
+
+// String returns translation in `from -> to` form
+func (t Translation) String() string {
+	return strings.Join(t.From, "/") + " -> " + strings.Join(t.To, "/")
+}
+
+// Reverse returns translations that undo these translations
+func (t Translations) Reverse() Translations {
+	result := make(Translations, len(t))
+	for i, tr := range t {
+		result[i] = Translation{From: tr.To, To: tr.From}
+	}
+	return result
+}
+
+// Apply translates client and service identifiers in SOAP header of body. Body is returned as is when it has
+// nothing to translate
+func (t Translations) Apply(body []byte) ([]byte, error) {
+	if len(t) == 0 {
+		return body, nil
+	}
+	root, err := xmldoc.NewDocument(body).Root()
+	if err != nil {
+		return body, err
+	}
+	identifiers, err := xmlquery.QueryAll(root, headerIdentifiers)
+	if err != nil {
+		return body, errors.Wrap(err, "failed to select X-road header identifiers")
+	}
+
+	changed := false
+	for _, identifier := range identifiers {
+		if t.translate(identifier) {
+			changed = true
+		}
+	}
+	if !changed {
+		return body, nil
+	}
+	return xmldoc.Output(root), nil
+}
+
+// translate applies first translation matching identifier element. Returns true when identifier was changed
+func (t Translations) translate(identifier *xmlquery.Node) bool {
+	parts := make([]*xmlquery.Node, 0, len(identifierParts))
+	for _, name := range identifierParts {
+		part := childElement(identifier, name)
+		if part == nil {
+			break
+		}
+		parts = append(parts, part)
+	}
+
+	for _, tr := range t {
+		if !tr.match(parts) {
+			continue
+		}
+		for i, to := range tr.To {
+			for child := parts[i].FirstChild; child != nil; child = parts[i].FirstChild {
+				xmlquery.RemoveFromTree(child)
+			}
+			xmlquery.AddChild(parts[i], &xmlquery.Node{Type: xmlquery.TextNode, Data: to})
+		}
+		return true
+	}
+	return false
+}
+
+func (t Translation) match(parts []*xmlquery.Node) bool {
+	if len(parts) < len(t.From) {
+		return false
+	}
+	for i, from := range t.From {
+		if strings.TrimSpace(parts[i].InnerText()) != from {
+			return false
+		}
+	}
+	return true
+}
+
+func childElement(n *xmlquery.Node, localName string) *xmlquery.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == xmlquery.ElementNode && child.Data == localName {
+			return child
+		}
+	}
+	return nil
+}
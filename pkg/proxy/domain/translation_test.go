@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const translationEnvelope = `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:iden="http://x-road.eu/xsd/identifiers" xmlns:xro="http://x-road.eu/xsd/xroad.xsd">
+  <s:Header>
+    <xro:client iden:objectType="SUBSYSTEM">
+      <iden:xRoadInstance>ee-test</iden:xRoadInstance>
+      <iden:memberClass>GOV</iden:memberClass>
+      <iden:memberCode>70009999</iden:memberCode>
+    </xro:client>
+    <xro:service iden:objectType="SERVICE">
+      <iden:xRoadInstance>ee-test</iden:xRoadInstance>
+      <iden:memberClass>GOV</iden:memberClass>
+      <iden:memberCode>70008899</iden:memberCode>
+      <iden:serviceCode>RR456</iden:serviceCode>
+    </xro:service>
+  </s:Header>
+  <s:Body><xRoadInstance>ee-test</xRoadInstance></s:Body>
+</s:Envelope>`
+
+func TestTranslationsApply(t *testing.T) {
+	translations, err := ConvertTranslations(config.TranslationConfigs{
+		{From: "ee-test", To: "ee-dev"},
+		{From: "ee-test/GOV/70008899", To: "ee-dev/COM/10000001"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := translations.Apply([]byte(translationEnvelope))
+
+	assert.NoError(t, err)
+	expected := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:iden="http://x-road.eu/xsd/identifiers" xmlns:xro="http://x-road.eu/xsd/xroad.xsd">
+  <s:Header>
+    <xro:client iden:objectType="SUBSYSTEM">
+      <iden:xRoadInstance>ee-dev</iden:xRoadInstance>
+      <iden:memberClass>GOV</iden:memberClass>
+      <iden:memberCode>70009999</iden:memberCode>
+    </xro:client>
+    <xro:service iden:objectType="SERVICE">
+      <iden:xRoadInstance>ee-dev</iden:xRoadInstance>
+      <iden:memberClass>COM</iden:memberClass>
+      <iden:memberCode>10000001</iden:memberCode>
+      <iden:serviceCode>RR456</iden:serviceCode>
+    </xro:service>
+  </s:Header>
+  <s:Body><xRoadInstance>ee-test</xRoadInstance></s:Body>
+</s:Envelope>`
+	assert.Equal(t, expected, string(result))
+
+	reversed, err := translations.Reverse().Apply(result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, translationEnvelope, string(reversed))
+}
+
+func TestTranslationsApplyWithoutMatch(t *testing.T) {
+	translations, err := ConvertTranslations(config.TranslationConfigs{{From: "ee-prod", To: "ee-dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(translationEnvelope)
+
+	result, err := translations.Apply(body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, translationEnvelope, string(result))
+
+	result, _ = translations.Apply([]byte("not xml"))
+	assert.Equal(t, "not xml", string(result))
+}
+
+func TestNewTranslationInvalid(t *testing.T) {
+	_, err := NewTranslation("ee-test/GOV", "ee-dev")
+	assert.EqualError(t, err, "translation 'ee-test/GOV' and 'ee-dev' must have same number of identifier parts")
+
+	_, err = NewTranslation("a/b/c/d/e", "a/b/c/d/f")
+	assert.EqualError(t, err, "translation 'a/b/c/d/e' has too many identifier parts")
+
+	_, err = NewTranslation("ee-test//1", "ee-dev/GOV/1")
+	assert.EqualError(t, err, "translation 'ee-test//1' to 'ee-dev/GOV/1' has empty identifier part")
+}
+
+func TestTranslationsApplyKeepsPrefixesOfSameNamespace(t *testing.T) {
+	translations, err := ConvertTranslations(config.TranslationConfigs{{From: "ee-test", To: "ee-dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// identifiers namespace is bound to `iden` in envelope and to `id` in client element
+	body := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:iden="http://x-road.eu/xsd/identifiers" xmlns:xro="http://x-road.eu/xsd/xroad.xsd">
+  <s:Header>
+    <xro:client xmlns:id="http://x-road.eu/xsd/identifiers" id:objectType="MEMBER">
+      <id:xRoadInstance>ee-test</id:xRoadInstance>
+      <id:memberClass>GOV</id:memberClass>
+      <id:memberCode>70009999</id:memberCode>
+    </xro:client>
+    <xro:service iden:objectType="SERVICE">
+      <iden:xRoadInstance>ee-test</iden:xRoadInstance>
+      <iden:memberClass>GOV</iden:memberClass>
+      <iden:memberCode>70008899</iden:memberCode>
+      <iden:serviceCode>RR456</iden:serviceCode>
+    </xro:service>
+  </s:Header>
+  <s:Body/>
+</s:Envelope>`
+
+	result, err := translations.Apply([]byte(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Replace(body, ">ee-test<", ">ee-dev<", -1), string(result))
+}
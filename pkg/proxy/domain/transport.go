@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpproxy"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxConnsPerHost     = 25 // we should usually have very few different clients connecting
+)
+
+// TransportSettings describes timeouts and connection pool of proxy server transport
+type TransportSettings struct {
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	DisableKeepAlives     bool
+	ForceHTTP2            bool
+	Proxy                 OutboundProxy
+}
+
+// OutboundProxy is HTTP/HTTPS proxy that requests to server are sent through. Proxy credentials are part of URL
+type OutboundProxy struct {
+	URL     *url.URL
+	NoProxy []string
+}
+
+// NewOutboundProxy creates outbound proxy from its url, optional basic authentication credentials and list of hosts
+// that are connected to directly. Empty url results empty proxy
+func NewOutboundProxy(proxyURL string, username string, password string, noProxy []string) (OutboundProxy, error) {
+	if proxyURL == "" {
+		if username != "" || len(noProxy) > 0 {
+			return OutboundProxy{}, errors.New("outbound proxy url must be set")
+		}
+		return OutboundProxy{}, nil
+	}
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return OutboundProxy{}, errors.Wrap(err, "failed to parse outbound proxy url")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return OutboundProxy{}, errors.Errorf("invalid outbound proxy url '%v', expected http or https scheme", proxyURL)
+	}
+	if username != "" {
+		parsed.User = url.UserPassword(username, password)
+	}
+	return OutboundProxy{URL: parsed, NoProxy: noProxy}, nil
+}
+
+// IsEmpty returns true when outbound proxy is not configured
+func (p OutboundProxy) IsEmpty() bool {
+	return p.URL == nil
+}
+
+// ProxyFunc returns function choosing proxy for request. Nil (direct connection) is returned when outbound proxy is
+// not configured. Proxy environment variables of host (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) are never honoured as every
+// server transport is built by ProxyServerTransport
+func (p OutboundProxy) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if p.IsEmpty() {
+		return nil
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  p.URL.String(),
+		HTTPSProxy: p.URL.String(),
+		NoProxy:    strings.Join(p.NoProxy, ","),
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+// ConvertTransportSettings converts configuration to transport settings. Omitted values get defaults
+func ConvertTransportSettings(conf config.TransportConf) (TransportSettings, error) {
+	settings := TransportSettings{
+		DialTimeout:           conf.DialTimeout,
+		KeepAlive:             conf.KeepAlive,
+		TLSHandshakeTimeout:   conf.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+		Timeout:               conf.Timeout,
+		IdleConnTimeout:       conf.IdleConnTimeout,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		DisableKeepAlives:     conf.DisableKeepAlives,
+		ForceHTTP2:            conf.ForceHTTP2,
+	}
+	return settings.withDefaults()
+}
+
+func (s TransportSettings) withDefaults() (TransportSettings, error) {
+	if s.DialTimeout < 0 || s.KeepAlive < 0 || s.TLSHandshakeTimeout < 0 || s.ResponseHeaderTimeout < 0 ||
+		s.Timeout < 0 || s.IdleConnTimeout < 0 || s.MaxIdleConns < 0 || s.MaxIdleConnsPerHost < 0 || s.MaxConnsPerHost < 0 {
+		return TransportSettings{}, errors.New("transport timeouts and connection limits can not be negative")
+	}
+	if s.DialTimeout == 0 {
+		s.DialTimeout = defaultDialTimeout
+	}
+	if s.KeepAlive == 0 {
+		s.KeepAlive = defaultKeepAlive
+	}
+	if s.TLSHandshakeTimeout == 0 {
+		s.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	if s.IdleConnTimeout == 0 {
+		s.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if s.MaxIdleConns == 0 {
+		s.MaxIdleConns = defaultMaxIdleConns
+	}
+	if s.MaxConnsPerHost == 0 {
+		s.MaxConnsPerHost = defaultMaxConnsPerHost
+	}
+	return s, nil
+}
+
+// DefaultTransportSettings returns transport settings with all values set to defaults
+func DefaultTransportSettings() TransportSettings {
+	settings, _ := TransportSettings{}.withDefaults()
+	return settings
+}
+
+// ProxyServerTransport creates proxy server transport for given TLS configuration and settings. Requests taking longer
+// than settings overall timeout (including reading response body) are cancelled
+func ProxyServerTransport(tlsClientConf *tls.Config, settings TransportSettings) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: settings.KeepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:                 settings.Proxy.ProxyFunc(),
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsClientConf,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		DisableKeepAlives:     settings.DisableKeepAlives,
+		ForceAttemptHTTP2:     settings.ForceHTTP2,
+	}
+	if settings.Timeout <= 0 {
+		return transport
+	}
+	return &timeoutTransport{transport: transport, timeout: settings.Timeout}
+}
+
+// timeoutTransport cancels request when response (including body) is not received within timeout
+type timeoutTransport struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	res, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &timeoutError{errors.Wrapf(err, "request timed out after %v", t.timeout)}
+		}
+		return nil, err
+	}
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// timeoutError marks error as timeout (net.Error) so retry policy can distinguish it
+type timeoutError struct {
+	error
+}
+
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
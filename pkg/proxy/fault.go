@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/compression"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// soapHeaderContextKey is context key for X-road header of proxied request
+type soapHeaderContextKey struct{}
+
+func soapHeaderFromContext(ctx context.Context) soap.Header {
+	header, _ := ctx.Value(soapHeaderContextKey{}).(soap.Header)
+	return header
+}
+
+// errorHandler responds with X-road SOAP fault when request could not be proxied to server and stores failed
+// exchange to request cache
+func (p *proxy) errorHandler(rw http.ResponseWriter, req *http.Request, err error) {
+	if req.Context().Err() == context.Canceled {
+		// client went away, nobody to respond to
+		p.logger.Warn().Err(err).Str("url.host", req.URL.Host).Msg("proxied request cancelled by client")
+		return
+	}
+
+	if err == errInjectedConnectionReset {
+		p.logger.Info().Str("url.host", req.URL.Host).Msg("resetting client connection for injected fault")
+		p.storeFailedRequest(req, soapHeaderFromContext(req.Context()), nil, err)
+		resetConnection(rw)
+		return
+	}
+
+	faultCode := faultCodeForError(err)
+	faultString := fmt.Sprintf("failed to proxy request to '%v': %v", req.URL.Host, err)
+	header := soapHeaderFromContext(req.Context())
+	body := soap.NewFault(header, faultCode, faultString)
+
+	p.logger.Error().Err(err).
+		Str("url.host", req.URL.Host).
+		Str("faultCode", faultCode).
+		Msg("failed to proxy request")
+
+	p.storeFailedRequest(req, header, body, err)
+
+	rw.Header().Set("Content-Type", "text/xml; charset=UTF-8")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rw.WriteHeader(http.StatusInternalServerError)
+	_, _ = rw.Write(body)
+}
+
+func (p *proxy) storeFailedRequest(req *http.Request, header soap.Header, fault []byte, err error) {
+	now := time.Now()
+
+	requestID := req.Header.Get(requestIDHeader)
+	cached, ok := p.cache.Get(requestID)
+	if !ok {
+		// requests without matching rule are not cached before they are sent. They are sent to default server
+		cached = domain.Request{
+			ID:          fmt.Sprintf("%v", rand.Uint64()),
+			Server:      p.defaultServer.Name,
+			RequestTime: now,
+		}
+		if header != (soap.Header{}) {
+			cached.Service = header.ServiceName()
+		}
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				cached.Request, _ = ioutil.ReadAll(body)
+				if contentEncoding := req.Header.Get("Content-Encoding"); compression.IsSupported(contentEncoding) {
+					if decoded, err := compression.Decode(contentEncoding, cached.Request); err == nil {
+						cached.Request = decoded
+					}
+				}
+				cached.RequestSize = int64(len(cached.Request))
+			}
+		}
+	}
+	cached.Response = fault
+	cached.ResponseTime = now
+	cached.ResponseSize = int64(len(fault))
+	cached.Error = err.Error()
+	p.cache.Set(cached)
+}
+
+// faultCodeForError returns X-road fault code best describing error
+func faultCodeForError(err error) string {
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.CertificateInvalidError, x509.HostnameError, tls.RecordHeaderError:
+		return soap.FaultCodeSslAuthenticationFailed
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "x509:") || strings.Contains(msg, "tls:") {
+		return soap.FaultCodeSslAuthenticationFailed
+	}
+	return soap.FaultCodeNetworkError
+}
+
+// faultResponse creates response with X-road SOAP fault body in place of response from server
+func faultResponse(req *http.Request, faultCode string, faultString string) *http.Response {
+	body := soap.NewFault(soapHeaderFromContext(req.Context()), faultCode, faultString)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)),
+		StatusCode:    http.StatusInternalServerError,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/xml; charset=UTF-8"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// injectedFaultContextKey is context key for fault injected into proxied request
+type injectedFaultContextKey struct{}
+
+// errInjectedConnectionReset is returned by transport when client connection must be reset instead of responding
+var errInjectedConnectionReset = errors.New("injected connection reset")
+
+func injectedFaultFromContext(ctx context.Context) domain.InjectedFault {
+	fault, _ := ctx.Value(injectedFaultContextKey{}).(domain.InjectedFault)
+	return fault
+}
+
+// injectFault applies latency and faults that replace proxying request. Returned response or error is used instead
+// of sending request to server. Both are nil when request must be proxied
+func (s transportSwitcher) injectFault(req *http.Request) (*http.Response, error) {
+	fault := injectedFaultFromContext(req.Context())
+	if fault.IsEmpty() {
+		return nil, nil
+	}
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch fault.Kind {
+	case domain.FaultErrorStatus:
+		return statusResponse(req, fault.Status), nil
+	case domain.FaultSOAPFault:
+		return faultResponse(req, fault.FaultCode, fault.FaultString), nil
+	case domain.FaultConnectionReset:
+		return nil, errInjectedConnectionReset
+	}
+	return nil, nil
+}
+
+// injectBodyFault replaces response body for faults that need real response from server. Returned content length
+// is what response declares, for truncated body it is larger than returned body
+func injectBodyFault(fault domain.InjectedFault, body []byte) ([]byte, int64) {
+	switch fault.Kind {
+	case domain.FaultEmptyBody:
+		return []byte{}, 0
+	case domain.FaultTruncatedBody:
+		return body[:len(body)/2], int64(len(body))
+	}
+	return body, int64(len(body))
+}
+
+// statusResponse creates response with given status and its status text as body in place of response from server
+func statusResponse(req *http.Request, status int) *http.Response {
+	body := []byte(http.StatusText(status))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// resetConnection closes client connection with TCP RST. Connections that can not be hijacked (HTTP/2) are aborted
+func resetConnection(rw http.ResponseWriter) {
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
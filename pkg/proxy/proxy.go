@@ -2,7 +2,11 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/compression"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/matcher"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/request"
@@ -10,8 +14,10 @@ import (
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/server"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -28,6 +34,15 @@ const (
 	requestRuleIDHeader string = "X-Xroad-Proxy-Rule-ID"
 )
 
+// matchedRuleContextKey is context key for rule matched to proxied request
+type matchedRuleContextKey struct{}
+
+// templateDataContextKey is context key for request data available to templated values
+type templateDataContextKey struct{}
+
+// translatedServerContextKey is context key for name of server whose translations were applied to proxied request
+type translatedServerContextKey struct{}
+
 type proxy struct {
 	logger *zerolog.Logger
 	cache  request.Storage
@@ -35,6 +50,8 @@ type proxy struct {
 	serverService server.AccessorService
 	ruleService   rule.Service
 
+	trustedProxies remoteaddr.Matcher
+
 	defaultServer domain.ProxyServer
 	proxyHandler  http.Handler
 }
@@ -49,6 +66,7 @@ func NewProxyHandler(
 	serverService server.AccessorService,
 	ruleService rule.Service,
 	cache request.Storage,
+	trustedProxies remoteaddr.Matcher,
 ) (http.Handler, error) {
 	defaultServer, ok := serverService.DefaultServer()
 	if !ok {
@@ -61,6 +79,8 @@ func NewProxyHandler(
 		ruleService:   ruleService,
 		cache:         cache,
 
+		trustedProxies: trustedProxies,
+
 		defaultServer: defaultServer,
 	}
 	proxy.proxyHandler = proxy.createProxyHandler()
@@ -69,15 +89,16 @@ func NewProxyHandler(
 }
 
 func (p *proxy) createProxyHandler() http.Handler {
-	defaultProxyURL := p.defaultServer.Address
-
 	director := func(req *http.Request) {
-		proxyURL := defaultProxyURL
+		var proxyURL url.URL
 		if req.Body != nil {
 			if tmpURL := p.processBody(req); tmpURL != nil {
 				proxyURL = *tmpURL
 			}
 		}
+		if proxyURL.Host == "" {
+			proxyURL = p.healthyServer(p.defaultServer, nil).SelectAddress()
+		}
 
 		// Host header needs to be changed to match our target server hostname otherwise target http server does
 		// not understand that request is mean for it
@@ -96,92 +117,290 @@ func (p *proxy) createProxyHandler() http.Handler {
 	switcher := transportSwitcher{
 		logger:        p.logger,
 		serverService: p.serverService,
+		cache:         p.cache,
 	}
 	if p.defaultServer.Transport != nil {
 		switcher.Transport = p.defaultServer.Transport
 	}
 	proxy.Transport = switcher
 
-	proxy.ModifyResponse = p.modifyResponse
+	proxy.ModifyResponse = func(r *http.Response) error {
+		if err := p.modifyResponse(r); err != nil {
+			return err
+		}
+		p.shapeResponse(r)
+		return nil
+	}
+	proxy.ErrorHandler = p.errorHandler
 
 	return proxy
 }
 
 func (p *proxy) processBody(req *http.Request) *url.URL {
 	// read all bytes from content body and create new stream using it.
-	requestBody, _ := ioutil.ReadAll(req.Body)
+	rawBody, _ := ioutil.ReadAll(req.Body)
+
+	// compressed body is decoded for matching, replacements and storage and is encoded back before it is proxied
+	contentEncoding := req.Header.Get("Content-Encoding")
+	requestBody := rawBody
+	if compression.IsSupported(contentEncoding) {
+		decoded, err := compression.Decode(contentEncoding, rawBody)
+		if err != nil {
+			setBody(req, rawBody)
+			p.logger.Error().Err(err).Msg("unable to decode compressed request body")
+			return nil
+		}
+		requestBody = decoded
+	}
 
 	// TODO: handle multipart requests - detect from headers?
 	// TODO: "Content-Type: Multipart/Related" https://www.w3.org/TR/SOAP-attachments
 	soapService, err := soap.FromRequestBody(requestBody)
 	if err != nil {
 		// let request through if we can not handle it. it will go to default server
-		req.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
+		setBody(req, rawBody)
 		p.logger.Error().Err(err).Msg("unable to extract service info from request")
 		return nil
 	}
 	serviceName := soapService.Service
+	*req = *req.WithContext(context.WithValue(req.Context(), soapHeaderContextKey{}, soapService.Header))
 
 	logRow := p.logger.Info().Str("serviceName", serviceName)
 
-	// TODO match Request.Header
-	matchedRule, ok := p.ruleService.GetAll().MatchRemoteAddr(req.RemoteAddr).MatchService(serviceName).MatchRegex(requestBody)
+	scenario := req.Header.Get(matcher.ScenarioHeader)
+	clientIP := remoteaddr.ClientIP(req, p.trustedProxies)
+	matchedRule, ok := p.matchRule(soapService.Header, requestBody, clientIP, scenario)
 	if !ok {
-		req.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
 		logRow.Msg("received SOAP message without matching rule")
-		return nil
+		return p.proxyToDefault(req, requestBody, rawBody, contentEncoding)
+	}
+
+	serverName, weightBucket := matchedRule.SelectServer(soapService.Header)
+	matchedServer, serverFound := p.serverService.Find(serverName)
+	if !serverFound {
+		// rule is not applied (no faults, header operations or replacements) to request sent to default server
+		p.logger.Error().Int64("ruleID", matchedRule.ID).Str("server", serverName).Msg("failed to find server matching rule")
+		return p.proxyToDefault(req, requestBody, rawBody, contentEncoding)
+	}
+	matchedServer = p.healthyServer(matchedServer, matchedRule.FallbackServers)
+	serverName = matchedServer.Name
+
+	shadows := shadowsFor(matchedRule)
+
+	fault := matchedRule.Faults.Roll(rand.Float64)
+	if !fault.IsEmpty() {
+		*req = *req.WithContext(context.WithValue(req.Context(), injectedFaultContextKey{}, fault))
 	}
 
 	requestID := fmt.Sprintf("%v", rand.Uint64())
 	p.cache.Set(domain.Request{
-		ID:          requestID,
-		RuleID:      matchedRule.ID,
-		Service:     serviceName,
-		RequestTime: time.Now(),
-		Request:     requestBody,
-		RequestSize: int64(len(requestBody)),
+		ID:           requestID,
+		RuleID:       matchedRule.ID,
+		Server:       serverName,
+		WeightBucket: weightBucket,
+		Scenario:     scenario,
+		Service:      serviceName,
+		RequestTime:  time.Now(),
+		Request:      requestBody,
+		RequestSize:  int64(len(requestBody)),
+		Shadows:      shadows,
+		Fault:        fault.String(),
 	})
 	req.Header.Add(requestIDHeader, requestID)
 	// ruleID is also in header because by the time response arrives our LRU cache can be already dropped request
 	// object but we need rule to response replacements to work
 	req.Header.Add(requestRuleIDHeader, strconv.Itoa(int(matchedRule.ID)))
 
-	logRow.Str("requestID", requestID).Int64("ruleID", matchedRule.ID).Msg("Matched to rule")
+	*req = *req.WithContext(context.WithValue(req.Context(), matchedRuleContextKey{}, matchedRule))
+
+	captures, namedCaptures := matchedRule.Captures(requestBody)
+	templateData := domain.TemplateData{
+		RequestID:     requestID,
+		RuleID:        matchedRule.ID,
+		Server:        serverName,
+		Scenario:      scenario,
+		Service:       serviceName,
+		ClientIP:      clientIPString(clientIP),
+		Header:        soapService.Header,
+		Captures:      captures,
+		NamedCaptures: namedCaptures,
+		Now:           time.Now(),
+	}
+	*req = *req.WithContext(context.WithValue(req.Context(), templateDataContextKey{}, templateData))
+	for _, err := range matchedRule.RequestHeaders.Apply(req.Header, templateData) {
+		p.logger.Error().Err(err).Str("requestID", requestID).Msg("failed to apply request header operation")
+	}
+
+	logRow.Str("requestID", requestID).
+		Int64("ruleID", matchedRule.ID).
+		Str("server", serverName).
+		Str("fault", fault.String()).
+		Msg("Matched to rule")
 
-	matchedServer, ok := p.serverService.Find(matchedRule.Server)
+	if len(matchedRule.RequestReplacements) > 0 {
+		var errs []error
+		requestBody, errs = matchedRule.ApplyRequestReplacements(requestBody, templateData)
+		for _, err := range errs {
+			p.logger.Error().Err(err).Str("requestID", requestID).Msg("failed to apply request replacement")
+		}
+	}
+	// shadow servers get request before translation as each of them translates it to its own environment
+	if shadows != nil {
+		p.mirror(req, requestBody, contentEncoding, matchedRule.ShadowServers, shadows)
+	}
+	if len(matchedRule.RequestReplacements) > 0 || len(matchedServer.Translations) > 0 {
+		// translation is done last so request reaches server with identifiers of server environment
+		requestBody = p.translateRequest(req, matchedServer, requestBody)
+		rawBody = encodeBody(contentEncoding, requestBody)
+		setContentLength(req, rawBody)
+	}
+
+	setBody(req, rawBody)
+	address := matchedServer.SelectAddress()
+	return &address
+}
+
+// proxyToDefault sends request that did not match any rule (or server of matched rule) to default server or its
+// fallback. Request identifiers are translated to environment of that server
+func (p *proxy) proxyToDefault(req *http.Request, requestBody []byte, rawBody []byte, contentEncoding string) *url.URL {
+	server := p.healthyServer(p.defaultServer, nil)
+	if len(server.Translations) > 0 {
+		rawBody = encodeBody(contentEncoding, p.translateRequest(req, server, requestBody))
+		setContentLength(req, rawBody)
+	}
+
+	setBody(req, rawBody)
+	address := server.SelectAddress()
+	return &address
+}
+
+// translateRequest translates request identifiers to environment of server. Server name is stored in request context
+// so that response identifiers are translated back even when request did not match any rule
+func (p *proxy) translateRequest(req *http.Request, server domain.ProxyServer, body []byte) []byte {
+	if len(server.Translations) == 0 {
+		return body
+	}
+	*req = *req.WithContext(context.WithValue(req.Context(), translatedServerContextKey{}, server.Name))
+
+	translated, err := server.Translations.Apply(body)
+	if err != nil {
+		p.logger.Error().Err(err).
+			Str("requestID", req.Header.Get(requestIDHeader)).
+			Msg("failed to translate request identifiers")
+	}
+	return translated
+}
+
+func setContentLength(req *http.Request, body []byte) {
+	requestSize := int64(len(body))
+
+	req.ContentLength = requestSize
+	req.Header.Set("Content-Length", strconv.Itoa(int(requestSize)))
+}
+
+// healthyServer returns given server when it is healthy or otherwise first healthy server from fallbacks (rule
+// fallbacks before server own fallbacks). Unhealthy server is still returned when none of the fallbacks are healthy
+func (p *proxy) healthyServer(s domain.ProxyServer, ruleFallbacks []string) domain.ProxyServer {
+	if s.IsHealthy() {
+		return s
+	}
+
+	fallbacks := append(append([]string{}, ruleFallbacks...), s.FallbackServers...)
+	fallback, ok := p.serverService.Servers().FindHealthy(fallbacks)
 	if !ok {
-		p.logger.Error().Msg("failed to find server matching rule")
+		p.logger.Warn().Str("server", s.Name).Msg("server is unhealthy and has no healthy fallback servers")
+		return s
+	}
+	p.logger.Info().Str("server", s.Name).Str("fallback", fallback.Name).Msg("server is unhealthy, using fallback")
+	return fallback
+}
 
-		req.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
-		return nil
+// encodeBody encodes decoded body back with given content encoding. Body with unsupported encoding was never decoded
+// and is returned as is
+func encodeBody(contentEncoding string, body []byte) []byte {
+	if !compression.IsSupported(contentEncoding) {
+		return body
 	}
+	// decoding with same encoding succeeded so encoding does not fail
+	encoded, _ := compression.Encode(contentEncoding, body)
+	return encoded
+}
 
-	if len(matchedRule.RequestReplacements) > 0 {
-		requestBody = matchedRule.ApplyRequestReplacements(requestBody)
-		requestSize := int64(len(requestBody))
+// setBody sets request body so that it can be replayed (GetBody) when request is retried
+func setBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+}
 
-		req.ContentLength = requestSize
-		req.Header.Set("Content-Length", strconv.Itoa(int(requestSize)))
+func templateDataFromContext(ctx context.Context) domain.TemplateData {
+	data, _ := ctx.Value(templateDataContextKey{}).(domain.TemplateData)
+	return data
+}
+
+func clientIPString(ip net.IP) string {
+	if ip == nil {
+		return ""
 	}
+	return ip.String()
+}
+
+func matchedRuleFromContext(ctx context.Context) (domain.Rule, bool) {
+	matchedRule, ok := ctx.Value(matchedRuleContextKey{}).(domain.Rule)
+	return matchedRule, ok
+}
 
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(requestBody))
-	return &matchedServer.Address
+// matchRule finds rule for request and marks it as used. Matching is repeated when matched rule ran out of matches
+// or expired meanwhile (concurrent request used it up)
+func (p *proxy) matchRule(
+	header soap.Header,
+	requestBody []byte,
+	clientIP net.IP,
+	scenario string,
+) (domain.Rule, bool) {
+	request := matcher.NewRequest(header, requestBody, clientIP)
+	for {
+		rules := p.ruleService.GetAll().
+			MatchActive(time.Now()).
+			MatchRemoteAddr(clientIP).
+			MatchService(header.Service).
+			MatchHeader(header)
+
+		matchedRule, ok := domain.Rule{}, false
+		if scenario != "" {
+			matchedRule, ok = rules.MatchScenario(scenario).MatchRequest(request)
+		}
+		if !ok {
+			matchedRule, ok = rules.MatchScenario("").MatchRequest(request)
+		}
+		if !ok {
+			return domain.Rule{}, false
+		}
+		if usedRule, ok := p.ruleService.Use(matchedRule.ID); ok {
+			return usedRule, true
+		}
+	}
 }
 
 func (p *proxy) modifyResponse(r *http.Response) error {
 	requestID := r.Request.Header.Get(requestIDHeader)
 	ruleIDStr := r.Request.Header.Get(requestRuleIDHeader)
-	if ruleIDStr == "" && requestID == "" {
+	translatedServer, _ := r.Request.Context().Value(translatedServerContextKey{}).(string)
+	if ruleIDStr == "" && requestID == "" && translatedServer == "" {
 		return nil
 	}
 
-	ruleID, err := strconv.Atoi(ruleIDStr)
-	if err != nil {
-		p.logger.Error().Err(err).Str("rule_id", ruleIDStr).Msg("failed to convert rule id to int")
-		return nil
+	ruleID := 0
+	if ruleIDStr != "" {
+		var err error
+		if ruleID, err = strconv.Atoi(ruleIDStr); err != nil {
+			p.logger.Error().Err(err).Str("rule_id", ruleIDStr).Msg("failed to convert rule id to int")
+			return nil
+		}
 	}
 
-	responseBody, err := ioutil.ReadAll(r.Body)
+	rawBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return err
 	}
@@ -190,23 +409,73 @@ func (p *proxy) modifyResponse(r *http.Response) error {
 		return err
 	}
 
+	// compressed response is decoded for replacements and storage and is encoded back before it is returned to client
+	contentEncoding := r.Header.Get("Content-Encoding")
+	responseBody := rawBody
+	if compression.IsSupported(contentEncoding) {
+		responseBody, err = compression.Decode(contentEncoding, rawBody)
+		if err != nil {
+			p.logger.Error().Err(err).Str("requestID", requestID).Msg("unable to decode compressed response body")
+			responseBody = rawBody
+			contentEncoding = ""
+		}
+	}
+
+	// translation is reversed first so replacements see identifiers of client environment
+	if server, found := p.serverService.Find(translatedServer); found && len(server.Translations) > 0 {
+		if responseBody, err = server.Translations.Reverse().Apply(responseBody); err != nil {
+			p.logger.Error().Err(err).Str("requestID", requestID).Msg("failed to translate response identifiers")
+		}
+	}
+
+	// primaryResponse is response before rule replacements and injected faults that shadow responses are compared to
+	primaryResponse := responseBody
 	if ruleID != 0 {
-		r, ok := p.ruleService.GetAll().FindByID(int64(ruleID))
-		if ok && len(r.ResponseReplacements) > 0 {
-			responseBody = r.ApplyResponseReplacements(responseBody)
+		// rule that ran out of matches is already removed from storage but is still available in request context
+		matchedRule, ok := matchedRuleFromContext(r.Request.Context())
+		if !ok {
+			matchedRule, ok = p.ruleService.GetAll().FindByID(int64(ruleID))
+		}
+		data := templateDataFromContext(r.Request.Context())
+		if ok && len(matchedRule.ResponseReplacements) > 0 {
+			var errs []error
+			responseBody, errs = matchedRule.ApplyResponseReplacements(responseBody, data)
+			for _, err := range errs {
+				p.logger.Error().Err(err).Str("requestID", requestID).Msg("failed to apply response replacement")
+			}
+		}
+		if ok && len(matchedRule.ResponseHeaders) > 0 {
+			for _, err := range matchedRule.ResponseHeaders.Apply(r.Header, data) {
+				p.logger.Error().Err(err).Str("requestID", requestID).Msg("failed to apply response header operation")
+			}
 		}
 	}
 
-	responseSize := int64(len(responseBody))
-	r.ContentLength = responseSize
-	r.Header.Set("Content-Length", strconv.Itoa(int(responseSize)))
+	clientBody := responseBody
+	if compression.IsSupported(contentEncoding) {
+		if clientBody, err = compression.Encode(contentEncoding, responseBody); err != nil {
+			return err
+		}
+	}
+
+	fault := injectedFaultFromContext(r.Request.Context())
+	clientBody, declaredSize := injectBodyFault(fault, clientBody)
+	r.ContentLength = declaredSize
+	r.Header.Set("Content-Length", strconv.Itoa(int(declaredSize)))
 
-	r.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	r.Body = ioutil.NopCloser(bytes.NewReader(clientBody))
+
+	responseBody, _ = injectBodyFault(fault, responseBody)
+	responseSize := int64(len(responseBody))
 
 	if requestID != "" {
 		cached, ok := p.cache.Get(requestID)
 		if ok {
 			cached.Response = responseBody
+			if cached.Shadows != nil {
+				cached.PrimaryResponse = primaryResponse
+				cached.Shadows.SetPrimary(primaryResponse)
+			}
 			cached.ResponseTime = time.Now()
 			cached.ResponseSize = responseSize
 			p.cache.Set(cached)
@@ -2,10 +2,19 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/compression"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/xmldiff"
+	commonConfig "github.com/aldas/xroad-mock-proxy/pkg/config/common"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/api/dto"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/request"
 	test_test "github.com/aldas/xroad-mock-proxy/test"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
@@ -14,6 +23,7 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 )
 
 // These 2 cert are copied from net.http.internal package. They are used to serve 'httptest.NewTLSServer'
@@ -124,7 +134,8 @@ func TestProxyMatchRuleToSelfSignedHTTPS(t *testing.T) {
 		Name:    "https",
 		Address: mockServer.URL,
 		TLS: &dto.TLSDTO{
-			CACert: LocalhostCert,
+			// httptest server certificate differs between Go versions so CA is taken from server itself
+			CACert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mockServer.Certificate().Raw})),
 			Cert:   LocalhostCert,
 			Key:    LocalhostKey,
 		},
@@ -159,6 +170,1010 @@ func TestProxyMatchRuleToSelfSignedHTTPS(t *testing.T) {
 	assert.Contains(t, response, "<Isik.Isikukood>{{.Identity}}</Isik.Isikukood>")
 }
 
+func TestProxyMatchRuleByHeader(t *testing.T) {
+	var testCases = []struct {
+		name           string
+		headerMatcher  commonConfig.HeaderMatcherConf
+		expectedStatus int
+	}{
+		{
+			name: "matching client is proxied to mock",
+			headerMatcher: commonConfig.HeaderMatcherConf{
+				Client: commonConfig.ClientIdentifierConf{MemberCode: "70009999", SubsystemCode: "mocksystem"},
+				UserID: "EE11111111111",
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "not matching client is proxied to default server",
+			headerMatcher: commonConfig.HeaderMatcherConf{
+				Client: commonConfig.ClientIdentifierConf{SubsystemCode: "othersystem"},
+			},
+			// default server is not running and request fails with SOAP fault
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockServer.Close()
+
+			requestBody := bytes.NewBuffer(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml"))
+			req, err := http.NewRequest("POST", XroadDefaulURL, requestBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			servers := domain.ProxyServers{
+				domain.ProxyServer{Address: parseURL(t, "http://localhost:7000"), Name: "default", IsDefault: true},
+				domain.ProxyServer{Address: parseURL(t, mockServer.URL), Name: "mock"},
+			}
+
+			ruleConfigs := config.RuleConfigs{
+				config.RuleConf{
+					Server:        "mock",
+					Service:       "rr.RR456.v1",
+					MatcherHeader: tc.headerMatcher,
+				},
+			}
+
+			recorder := serveWithProxy(t, req, servers, ruleConfigs)
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestProxyFailoverToHealthyServer(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		primaryHealthy  bool
+		expectedBackend string
+	}{
+		{
+			name:            "healthy server receives request",
+			primaryHealthy:  true,
+			expectedBackend: "primary",
+		},
+		{
+			name:            "unhealthy server request goes to fallback",
+			primaryHealthy:  false,
+			expectedBackend: "fallback",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receivedBy := ""
+			backend := func(name string) *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					receivedBy = name
+					w.WriteHeader(http.StatusOK)
+				}))
+			}
+			primaryServer := backend("primary")
+			defer primaryServer.Close()
+			fallbackServer := backend("fallback")
+			defer fallbackServer.Close()
+
+			primaryEndpoints, err := domain.NewEndpointPool("", []url.URL{parseURL(t, primaryServer.URL)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.primaryHealthy {
+				primaryEndpoints.Endpoints[0].Health.Report(errors.New("connection refused"), time.Now(), 1, 1)
+			}
+
+			requestBody := bytes.NewBuffer(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml"))
+			req, err := http.NewRequest("POST", XroadDefaulURL, requestBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			servers := domain.ProxyServers{
+				domain.ProxyServer{Address: parseURL(t, "http://localhost:7000"), Name: "default", IsDefault: true},
+				domain.ProxyServer{Address: parseURL(t, primaryServer.URL), Name: "primary", Endpoints: primaryEndpoints},
+				domain.ProxyServer{Address: parseURL(t, fallbackServer.URL), Name: "fallback"},
+			}
+
+			ruleConfigs := config.RuleConfigs{
+				config.RuleConf{
+					Server:          "primary",
+					FallbackServers: []string{"fallback"},
+					Service:         "rr.RR456.v1",
+				},
+			}
+
+			recorder := serveWithProxy(t, req, servers, ruleConfigs)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.expectedBackend, receivedBy)
+		})
+	}
+}
+
+func TestProxyRetriesWithReplayedBody(t *testing.T) {
+	var receivedBodies []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receivedBodies = append(receivedBodies, string(body))
+
+		if len(receivedBodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	requestBody := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address: mockServer.URL,
+			Name:    "xroad",
+			Retry: config.RetryConf{
+				MaxAttempts:   3,
+				Backoff:       time.Millisecond,
+				RetryOnStatus: []int{http.StatusServiceUnavailable},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{{Server: "xroad", Service: "rr.RR456.v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{string(requestBody), string(requestBody), string(requestBody)}, receivedBodies)
+
+	requests := cache.GetAll()
+	if assert.Len(t, requests, 1) {
+		attempts := requests[0].Attempts
+		assert.Len(t, attempts, 3)
+		assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+		assert.Equal(t, http.StatusOK, attempts[2].StatusCode)
+	}
+}
+
+func TestProxyCircuitBreakerFailsFast(t *testing.T) {
+	requestCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address:        mockServer.URL,
+			Name:           "xroad",
+			CircuitBreaker: config.CircuitBreakerConf{FailureThreshold: 2, OpenTimeout: time.Minute},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleConfigs := config.RuleConfigs{{Server: "xroad", Service: "rr.RR456.v1"}}
+
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := serveWithProxy(t, req, servers, ruleConfigs)
+
+		if i < 2 {
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			continue
+		}
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "<faultcode>Server.ClientProxy.NetworkError</faultcode>")
+	}
+	assert.Equal(t, 2, requestCount)
+
+	xroad, _ := servers.Find("xroad")
+	assert.Equal(t, domain.CircuitOpen, xroad.Breaker.Status().State)
+}
+
+func TestProxyRespondsWithSOAPFaultOnError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockServer.Close() // nothing listens on this address anymore
+
+	requestBody := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := domain.ProxyServers{
+		domain.ProxyServer{Address: parseURL(t, "http://localhost:7000"), Name: "default", IsDefault: true},
+		domain.ProxyServer{Address: parseURL(t, mockServer.URL), Name: "xroad"},
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{{Server: "xroad", Service: "rr.RR456.v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "text/xml; charset=UTF-8", recorder.Header().Get("Content-Type"))
+
+	response := recorder.Body.Bytes()
+	assert.True(t, soap.IsFault(response))
+	assert.Contains(t, string(response), "<faultcode>Server.ClientProxy.NetworkError</faultcode>")
+	envelope, err := soap.FromRequestBody(response)
+	assert.NoError(t, err)
+	assert.Equal(t, "nkvw9k2AVvrukYlVAGXRYg", envelope.Header.ID)
+	assert.Equal(t, "rr.RR456.v1", envelope.Service)
+
+	requests := cache.GetAll()
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, requestBody, requests[0].Request)
+		assert.Equal(t, response, requests[0].Response)
+		assert.Contains(t, requests[0].Error, "connection refused")
+	}
+}
+
+func TestProxyStoresFailedRequestWithDefaultServerName(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mockServer.Close() // nothing listens on this address anymore
+
+	var testCases = []struct {
+		name  string
+		rules config.RuleConfigs
+	}{
+		{
+			name:  "no matching rule",
+			rules: config.RuleConfigs{{Server: "default", Service: "rr.RR999.v1"}},
+		},
+		{
+			name:  "server of rule does not exist",
+			rules: config.RuleConfigs{{Server: "missing", Service: "rr.RR456.v1"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			servers := domain.ProxyServers{
+				domain.ProxyServer{Address: parseURL(t, mockServer.URL), Name: "default", IsDefault: true},
+			}
+			rules, err := domain.ConvertRules(tc.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger := zerolog.Nop()
+			cache := request.NewStorage(10, time.Minute)
+			proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			proxy.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+			requests := cache.GetAll()
+			if assert.Len(t, requests, 1) {
+				assert.Equal(t, "default", requests[0].Server)
+				assert.Contains(t, requests[0].Error, "connection refused")
+			}
+		})
+	}
+}
+
+func TestFaultCodeForError(t *testing.T) {
+	assert.Equal(t, soap.FaultCodeSslAuthenticationFailed, faultCodeForError(x509.UnknownAuthorityError{}))
+	assert.Equal(t, soap.FaultCodeSslAuthenticationFailed, faultCodeForError(errors.New("remote error: tls: bad certificate")))
+	assert.Equal(t, soap.FaultCodeNetworkError, faultCodeForError(errors.New("dial tcp 127.0.0.1:7000: connect: connection refused")))
+}
+
+func TestProxyBalancesBetweenEndpoints(t *testing.T) {
+	receivedBy := make(map[string]int)
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedBy[name]++
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	firstServer := backend("first")
+	defer firstServer.Close()
+	secondServer := backend("second")
+	defer secondServer.Close()
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Endpoints:     []string{firstServer.URL, secondServer.URL},
+			LoadBalancing: domain.LoadBalancingRoundRobin,
+			Name:          "xroad",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleConfigs := config.RuleConfigs{{Server: "xroad", Service: "rr.RR456.v1"}}
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := serveWithProxy(t, req, servers, ruleConfigs)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+	assert.Equal(t, map[string]int{"first": 2, "second": 2}, receivedBy)
+
+	xroad, _ := servers.Find("xroad")
+	for _, e := range xroad.Endpoints.Endpoints {
+		assert.Equal(t, int64(0), e.ActiveRequests())
+	}
+}
+
+func TestProxyThroughOutboundProxy(t *testing.T) {
+	var receivedURL, receivedAuth string
+	outboundProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedURL = r.URL.String()
+		receivedAuth = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer outboundProxy.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address: "http://security-server.example.com:8080",
+			Name:    "xroad",
+			OutboundProxy: config.OutboundProxyConf{
+				URL:      outboundProxy.URL,
+				Username: "user",
+				Password: "secret",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{Server: "xroad", Service: "rr.RR456.v1"}})
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "http://security-server.example.com:8080/cgi-bin/consumer_proxy", receivedURL)
+	assert.Equal(t, "Basic dXNlcjpzZWNyZXQ=", receivedAuth)
+}
+
+func TestProxyMirrorsToShadowServer(t *testing.T) {
+	primaryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<r><nimi>Mari</nimi></r>`))
+	}))
+	defer primaryServer.Close()
+
+	shadowReceived := make(chan string, 1)
+	shadowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		shadowReceived <- string(body)
+		_, _ = w.Write([]byte(`<r><nimi>Jaan</nimi></r>`))
+	}))
+	defer shadowServer.Close()
+
+	requestBody := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{Address: primaryServer.URL, Name: "xroad"},
+		config.ProxyServerConf{Address: shadowServer.URL, Name: "shadow"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{
+		{Server: "xroad", Service: "rr.RR456.v1", ShadowServers: []string{"shadow"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, `<r><nimi>Mari</nimi></r>`, recorder.Body.String())
+
+	select {
+	case body := <-shadowReceived:
+		assert.Equal(t, string(requestBody), body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow server did not receive mirrored request")
+	}
+
+	requests := cache.GetAll()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	var shadows []domain.ShadowResponse
+	for i := 0; i < 100; i++ {
+		shadows = requests[0].Shadows.All()
+		if shadows[0].Done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.Len(t, shadows, 1) {
+		assert.Equal(t, "shadow", shadows[0].Server)
+		assert.Equal(t, http.StatusOK, shadows[0].StatusCode)
+		assert.Equal(t, []xmldiff.Difference{
+			{Path: "/r/nimi/text()", Kind: xmldiff.KindChanged, Expected: "Mari", Actual: "Jaan"},
+		}, shadows[0].Differences)
+	}
+}
+
+func TestProxyComparesShadowToUnmodifiedPrimaryResponse(t *testing.T) {
+	// X-road servers echo request header in response
+	echo := func(received chan<- []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- body
+			_, _ = w.Write(body)
+		}
+	}
+	primaryReceived := make(chan []byte, 1)
+	primaryServer := httptest.NewServer(echo(primaryReceived))
+	defer primaryServer.Close()
+	shadowReceived := make(chan []byte, 1)
+	shadowServer := httptest.NewServer(echo(shadowReceived))
+	defer shadowServer.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address:      primaryServer.URL,
+			Name:         "xroad",
+			Translations: config.TranslationConfigs{{From: "ee-test", To: "ee-dev"}},
+		},
+		config.ProxyServerConf{
+			Address:      shadowServer.URL,
+			Name:         "shadow",
+			Translations: config.TranslationConfigs{{From: "ee-test", To: "ee-shadow"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{{
+		Server:               "xroad",
+		Service:              "rr.RR456.v1",
+		ShadowServers:        []string{"shadow"},
+		ResponseReplacements: config.ReplacementConfigs{{Regex: "38211020380", Value: "38001010000"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "38001010000")
+	assert.Contains(t, string(<-primaryReceived), "<iden:xRoadInstance>ee-dev</iden:xRoadInstance>")
+	select {
+	case body := <-shadowReceived:
+		assert.Contains(t, string(body), "<iden:xRoadInstance>ee-shadow</iden:xRoadInstance>")
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow server did not receive mirrored request")
+	}
+
+	requests := cache.GetAll()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	var shadows []domain.ShadowResponse
+	for i := 0; i < 100; i++ {
+		shadows = requests[0].Shadows.All()
+		if shadows[0].Done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Contains(t, string(requests[0].PrimaryResponse), "38211020380")
+	assert.Empty(t, shadows[0].Differences)
+}
+
+func TestProxyInjectsFaults(t *testing.T) {
+	upstreamBody := `<r><nimi>Mari</nimi></r>`
+	var testCases = []struct {
+		name             string
+		faults           config.FaultsConf
+		expectedStatus   int
+		expectedBody     string
+		expectedLength   string
+		expectedUpstream bool
+	}{
+		{
+			name:           "error status",
+			faults:         config.FaultsConf{ErrorStatus: config.ErrorStatusFaultConf{Probability: 1, Status: 502}},
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Bad Gateway",
+			expectedLength: "11",
+		},
+		{
+			name:             "empty body",
+			faults:           config.FaultsConf{EmptyBody: config.ProbabilityConf{Probability: 1}},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "",
+			expectedLength:   "0",
+			expectedUpstream: true,
+		},
+		{
+			name:             "truncated body",
+			faults:           config.FaultsConf{TruncatedBody: config.ProbabilityConf{Probability: 1}},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     upstreamBody[:len(upstreamBody)/2],
+			expectedLength:   "24",
+			expectedUpstream: true,
+		},
+		{
+			name: "latency",
+			faults: config.FaultsConf{
+				Latency: config.LatencyFaultConf{Probability: 1, Duration: time.Millisecond},
+			},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     upstreamBody,
+			expectedLength:   "24",
+			expectedUpstream: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstreamCalled := false
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalled = true
+				_, _ = w.Write([]byte(upstreamBody))
+			}))
+			defer mockServer.Close()
+
+			req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+				config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+				config.ProxyServerConf{Address: mockServer.URL, Name: "xroad"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := serveWithProxy(t, req, servers, config.RuleConfigs{
+				{Server: "xroad", Service: "rr.RR456.v1", Faults: tc.faults},
+			})
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			assert.Equal(t, tc.expectedBody, recorder.Body.String())
+			assert.Equal(t, tc.expectedLength, recorder.Header().Get("Content-Length"))
+			assert.Equal(t, tc.expectedUpstream, upstreamCalled)
+		})
+	}
+}
+
+func TestProxyInjectsSOAPFault(t *testing.T) {
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{Address: "http://localhost:7001", Name: "xroad"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "xroad",
+		Service: "rr.RR456.v1",
+		Faults: config.FaultsConf{
+			SOAPFault: config.SOAPFaultConf{Probability: 1, FaultCode: "Server.ServerProxy.ServiceFailed"},
+		},
+	}})
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.True(t, soap.IsFault(recorder.Body.Bytes()))
+	assert.Contains(t, recorder.Body.String(), "<faultcode>Server.ServerProxy.ServiceFailed</faultcode>")
+}
+
+func TestProxyInjectsConnectionReset(t *testing.T) {
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{Address: "http://localhost:7001", Name: "xroad"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{{
+		Server:  "xroad",
+		Service: "rr.RR456.v1",
+		Faults:  config.FaultsConf{ConnectionReset: config.ProbabilityConf{Probability: 1}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	res, err := http.Post(proxyServer.URL+XroadDefaulURL, "text/xml", bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err == nil {
+		_ = res.Body.Close()
+	}
+
+	assert.Error(t, err)
+	requests := cache.GetAll()
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, "connection_reset", requests[0].Fault)
+		assert.Equal(t, "injected connection reset", requests[0].Error)
+	}
+}
+
+func TestProxyShapesTraffic(t *testing.T) {
+	responseBody := bytes.Repeat([]byte("a"), 100)
+	var receivedBody []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		_, _ = w.Write(responseBody)
+	}))
+	defer mockServer.Close()
+
+	requestBody := test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address: mockServer.URL,
+			Name:    "xroad",
+			Shaping: config.ShapingConf{Latency: time.Second, ResponseBytesPerSecond: 1000},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "xroad",
+		Service: "rr.RR456.v1",
+		// rule latency overrides server latency, response limit is inherited from server
+		Shaping: config.ShapingConf{Latency: 50 * time.Millisecond},
+	}})
+	elapsed := time.Since(start)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, responseBody, recorder.Body.Bytes())
+	assert.Equal(t, requestBody, receivedBody)
+	// 50ms latency + 100 bytes at 1000 bytes per second
+	assert.True(t, elapsed >= 150*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < time.Second, "elapsed %v", elapsed)
+}
+
+func TestProxyAppliesHeaderOperations(t *testing.T) {
+	var receivedHeader http.Header
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header
+		w.Header().Set("Set-Cookie", "JSESSIONID=1")
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write([]byte(`<r/>`))
+	}))
+	defer mockServer.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cookie", "session=1")
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{Address: mockServer.URL, Name: "xroad"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "xroad",
+		Service: "rr.RR456.v1",
+		RequestHeaders: config.HeaderOperationConfigs{
+			{Operation: "set", Name: "X-Road-Service", Value: "{{ .Service }}"},
+			{Operation: "remove", Name: "Cookie"},
+		},
+		ResponseHeaders: config.HeaderOperationConfigs{
+			{Operation: "remove", Name: "Set-Cookie"},
+			{Operation: "set", Name: "Content-Type", Value: "text/xml; charset=UTF-8"},
+			{Operation: "add", Name: "X-Routed-To", Value: "{{ .Server }}"},
+		},
+	}})
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "rr.RR456.v1", receivedHeader.Get("X-Road-Service"))
+	assert.Empty(t, receivedHeader.Get("Cookie"))
+	assert.Empty(t, receivedHeader.Get(requestIDHeader))
+	assert.Empty(t, receivedHeader.Get(requestRuleIDHeader))
+
+	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
+	assert.Equal(t, "text/xml; charset=UTF-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "xroad", recorder.Header().Get("X-Routed-To"))
+}
+
+func TestProxyDoesNotApplyRuleWithMissingServer(t *testing.T) {
+	var receivedHeader http.Header
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header
+		_, _ = w.Write([]byte(`<r/>`))
+	}))
+	defer mockServer.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: mockServer.URL, Name: "default", IsDefault: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "missing",
+		Service: "rr.RR456.v1",
+		Faults: config.FaultsConf{
+			SOAPFault: config.SOAPFaultConf{Probability: 1},
+		},
+		RequestHeaders: config.HeaderOperationConfigs{
+			{Operation: "set", Name: "X-Road-Service", Value: "{{ .Service }}"},
+		},
+	}})
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "<r/>", recorder.Body.String())
+	if assert.NotNil(t, receivedHeader) {
+		assert.Empty(t, receivedHeader.Get("X-Road-Service"))
+	}
+}
+
+func TestProxyReplacesCompressedBodies(t *testing.T) {
+	var receivedBody []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receivedBody, _ = compression.Decode(r.Header.Get("Content-Encoding"), body)
+
+		response, _ := compression.Encode("gzip", []byte(`<r><xRoadInstance>ee-test</xRoadInstance></r>`))
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(response)
+	}))
+	defer mockServer.Close()
+
+	requestBody, err := compression.Encode("deflate", test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "deflate")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{Address: mockServer.URL, Name: "xroad"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := domain.ConvertRules(config.RuleConfigs{{
+		Server:               "xroad",
+		Service:              "rr.RR456.v1",
+		RequestReplacements:  config.ReplacementConfigs{{Regex: "RR456", Value: "RR457"}},
+		ResponseReplacements: config.ReplacementConfigs{{Regex: "ee-test", Value: "ee-dev"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	cache := request.NewStorage(10, time.Minute)
+	proxy, err := NewProxyHandler(&logger, serverMockService{servers: servers}, ruleMockService{Rules: rules}, cache, remoteaddr.Matcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, string(receivedBody), "RR457")
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	responseBody, err := compression.Decode("gzip", recorder.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, `<r><xRoadInstance>ee-dev</xRoadInstance></r>`, string(responseBody))
+
+	requests := cache.GetAll()
+	if assert.Len(t, requests, 1) {
+		assert.Contains(t, string(requests[0].Request), "RR456")
+		assert.Equal(t, `<r><xRoadInstance>ee-dev</xRoadInstance></r>`, string(requests[0].Response))
+	}
+}
+
+func TestProxyTranslatesIdentifiers(t *testing.T) {
+	var receivedBody []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		// X-road response echoes request header
+		_, _ = w.Write(receivedBody)
+	}))
+	defer mockServer.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{Address: "http://localhost:7000", Name: "default", IsDefault: true},
+		config.ProxyServerConf{
+			Address: mockServer.URL,
+			Name:    "xroad",
+			Translations: config.TranslationConfigs{
+				{From: "ee-test", To: "ee-dev"},
+				{From: "ee-test/GOV/70009999", To: "ee-dev/GOV/70000001"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "xroad",
+		Service: "rr.RR456.v1",
+	}})
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	received, err := soap.FromRequestBody(receivedBody)
+	assert.NoError(t, err)
+	assert.Equal(t, "ee-dev/GOV/70000001/mocksystem", received.Header.Client.String())
+	assert.Equal(t, "ee-dev", received.Header.Service.XRoadInstance)
+	assert.Equal(t, "70008899", received.Header.Service.MemberCode)
+
+	response, err := soap.FromRequestBody(recorder.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "ee-test/GOV/70009999/mocksystem", response.Header.Client.String())
+	assert.Equal(t, "ee-test", response.Header.Service.XRoadInstance)
+}
+
+func TestProxyTranslatesIdentifiersWithoutMatchingRule(t *testing.T) {
+	var receivedBody []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		// X-road response echoes request header
+		_, _ = w.Write(receivedBody)
+	}))
+	defer mockServer.Close()
+
+	req, err := http.NewRequest("POST", XroadDefaulURL, bytes.NewReader(test_test.LoadBytes(t, "rr.rr456.v1/rr456.paring.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := domain.ConvertProxyServers(config.ProxyServerConfigs{
+		config.ProxyServerConf{
+			Address:      mockServer.URL,
+			Name:         "default",
+			IsDefault:    true,
+			Translations: config.TranslationConfigs{{From: "ee-test", To: "ee-dev"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveWithProxy(t, req, servers, config.RuleConfigs{{
+		Server:  "default",
+		Service: "rr.RR999.v1",
+	}})
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	received, err := soap.FromRequestBody(receivedBody)
+	assert.NoError(t, err)
+	assert.Equal(t, "ee-dev/GOV/70009999/mocksystem", received.Header.Client.String())
+	assert.Equal(t, "ee-dev", received.Header.Service.XRoadInstance)
+
+	response, err := soap.FromRequestBody(recorder.Body.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "ee-test/GOV/70009999/mocksystem", response.Header.Client.String())
+	assert.Equal(t, "ee-test", response.Header.Service.XRoadInstance)
+}
+
 func serveWithProxy(
 	t *testing.T,
 	req *http.Request,
@@ -178,6 +1193,7 @@ func serveWithProxy(
 		serverMockService{servers: servers},
 		ruleMockService{Rules: rules},
 		ruleMockCache{},
+		remoteaddr.Matcher{},
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -229,6 +1245,10 @@ func (s ruleMockService) GetRule(ID int64) (domain.Rule, bool) {
 	return s.Rules[0], true
 }
 
+func (s ruleMockService) Use(ID int64) (domain.Rule, bool) {
+	return domain.Rules(s.Rules).FindByID(ID)
+}
+
 func (s ruleMockService) Save(rule domain.Rule) (domain.Rule, error) {
 	return domain.Rule{}, nil
 }
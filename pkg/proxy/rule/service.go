@@ -10,6 +10,7 @@ import (
 type Service interface {
 	GetAll() domain.Rules
 	GetRule(ID int64) (domain.Rule, bool)
+	Use(ID int64) (domain.Rule, bool)
 	Save(domain.Rule) (domain.Rule, error)
 	Remove(ID int64) bool
 }
@@ -35,6 +36,11 @@ func (s service) GetRule(ID int64) (domain.Rule, bool) {
 	return s.storage.GetRule(ID)
 }
 
+// Use marks rule as used by matched request. Returns false when rule has been removed/expired meanwhile
+func (s service) Use(ID int64) (domain.Rule, bool) {
+	return s.storage.Use(ID)
+}
+
 func (s service) Save(rule domain.Rule) (domain.Rule, error) {
 	if rule.ID != 0 {
 		tmp, ok := s.GetRule(rule.ID)
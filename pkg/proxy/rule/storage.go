@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -21,14 +22,17 @@ const (
 type Storage interface {
 	GetAll() domain.Rules
 	GetRule(ID int64) (domain.Rule, bool)
+	Use(ID int64) (domain.Rule, bool)
 	Save(domain.Rule) (domain.Rule, error)
 	Remove(ID int64) bool
 }
 
 type cacheStorage struct {
 	logger *zerolog.Logger
-	rules  domain.Rules
-	cache  gcache.Cache
+	// mutex guards config rules slice and read-modify-write of rules usage counters
+	mutex sync.Mutex
+	rules domain.Rules
+	cache gcache.Cache
 }
 
 // NewStorage creates new instance of rule storage using cache as storage
@@ -46,28 +50,37 @@ func NewStorage(logger *zerolog.Logger, rules domain.Rules, storageSize int, sto
 
 	gc := gcBuilder.Build()
 
+	// rules are copied because used up rules are removed from storage in place and caller slice must stay intact
 	return &cacheStorage{
 		logger: logger,
-		rules:  rules,
+		rules:  append(domain.Rules{}, rules...),
 		cache:  gc,
 	}
 }
 
-func (s cacheStorage) GetAll() domain.Rules {
+func (s *cacheStorage) GetAll() domain.Rules {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
 	raw := s.cache.GetALL(false)
 
-	rules := make(domain.Rules, len(raw))
-	i := 0
+	rules := make(domain.Rules, 0, len(raw)+len(s.rules))
 	for _, rawRule := range raw {
 		rule, _ := rawRule.(domain.Rule)
-		rules[i] = rule
-		i++
+		if !rule.IsExpired(now) {
+			rules = append(rules, rule)
+		}
 	}
-
-	return append(rules, s.rules...)
+	for _, rule := range s.rules {
+		if !rule.IsExpired(now) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
 }
 
-func (s cacheStorage) getRule(ID int64) (domain.Rule, bool) {
+func (s *cacheStorage) getRule(ID int64) (domain.Rule, bool) {
 	// assuming we do not have huge collection of rules from config looping over slice
 	// should be fast enough
 	for _, rule := range s.rules {
@@ -78,15 +91,62 @@ func (s cacheStorage) getRule(ID int64) (domain.Rule, bool) {
 	return domain.Rule{}, false
 }
 
-func (s cacheStorage) GetRule(ID int64) (domain.Rule, bool) {
+func (s *cacheStorage) GetRule(ID int64) (domain.Rule, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	rule, ok := s.getRule(ID)
-	if ok {
-		return rule, ok
+	if !ok {
+		rule, ok = s.cacheGet(ID)
+	}
+	if !ok || rule.IsExpired(time.Now()) {
+		return domain.Rule{}, false
+	}
+	return rule, true
+}
+
+// Use marks rule as used by matched request. Rule with limited number of matches has its remaining matches
+// decremented and is removed when they run out. Returns false when rule does not exist (anymore) or has expired.
+func (s *cacheStorage) Use(ID int64) (domain.Rule, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for i, rule := range s.rules {
+		if rule.ID != ID {
+			continue
+		}
+		used := rule.Use(now)
+		if !used || rule.IsExhausted() {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+		} else {
+			s.rules[i] = rule
+		}
+		if !used {
+			return domain.Rule{}, false
+		}
+		return rule, true
+	}
+
+	rule, ok := s.cacheGet(ID)
+	if !ok {
+		return domain.Rule{}, false
+	}
+	if !rule.Use(now) {
+		s.cache.Remove(ID)
+		return domain.Rule{}, false
 	}
-	return s.cacheGet(ID)
+	if rule.IsExhausted() {
+		s.cache.Remove(ID)
+	} else if rule.IsLimited() {
+		if err := s.cacheSet(rule); err != nil {
+			s.logger.Error().Err(err).Int64("rule_id", ID).Msg("failed to update rule remaining matches")
+		}
+	}
+	return rule, true
 }
 
-func (s cacheStorage) cacheGet(ID int64) (domain.Rule, bool) {
+func (s *cacheStorage) cacheGet(ID int64) (domain.Rule, bool) {
 	raw, err := s.cache.Get(ID)
 	if err != nil {
 		return domain.Rule{}, false
@@ -99,7 +159,17 @@ func (s cacheStorage) cacheGet(ID int64) (domain.Rule, bool) {
 	return rule, true
 }
 
-func (s cacheStorage) Save(r domain.Rule) (domain.Rule, error) {
+func (s *cacheStorage) cacheSet(r domain.Rule) error {
+	if r.ExpiresAt.IsZero() {
+		return s.cache.Set(r.ID, r)
+	}
+	return s.cache.SetWithExpire(r.ID, r, time.Until(r.ExpiresAt))
+}
+
+func (s *cacheStorage) Save(r domain.Rule) (domain.Rule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	var rule domain.Rule
 	var ok bool
 
@@ -122,13 +192,16 @@ func (s cacheStorage) Save(r domain.Rule) (domain.Rule, error) {
 		return rule, errors.New("can not modify read only rule")
 	}
 
-	if err := s.cache.Set(r.ID, r); err != nil {
+	if err := s.cacheSet(r); err != nil {
 		return r, errors.Wrap(err, "failed to store rule in cache")
 	}
 
 	return r, nil
 }
 
-func (s cacheStorage) Remove(ID int64) bool {
+func (s *cacheStorage) Remove(ID int64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	return s.cache.Remove(ID)
 }
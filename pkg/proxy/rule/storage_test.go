@@ -1,12 +1,14 @@
 package rule
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/usage"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
 	"github.com/bluele/gcache"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestSaveExistingRule(t *testing.T) {
@@ -34,3 +36,78 @@ func TestSaveExistingRule(t *testing.T) {
 	assert.Equal(t, r.ID, r2.ID)
 	assert.ObjectsAreEqual(r, r2)
 }
+
+func TestUseRuleWithMaxMatches(t *testing.T) {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	storage := cacheStorage{
+		logger: &logger,
+		rules:  domain.Rules{{ID: 1, Limit: usage.Limit{MaxMatches: 2, MatchesLeft: 2}}},
+		cache:  gcache.New(2).Simple().Build(),
+	}
+	cached, err := storage.Save(domain.Rule{Limit: usage.Limit{MaxMatches: 1, MatchesLeft: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, ok := storage.Use(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), r.MatchesLeft)
+
+	r, ok = storage.Use(1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), r.MatchesLeft)
+
+	_, ok = storage.Use(1)
+	assert.False(t, ok)
+
+	_, ok = storage.Use(cached.ID)
+	assert.True(t, ok)
+	_, ok = storage.Use(cached.ID)
+	assert.False(t, ok)
+
+	assert.Len(t, storage.GetAll(), 0)
+}
+
+func TestUseExpiredRule(t *testing.T) {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	storage := cacheStorage{
+		logger: &logger,
+		rules: domain.Rules{
+			{ID: 1, Limit: usage.Limit{ExpiresAt: time.Now().Add(-1 * time.Second)}},
+			{ID: 2, Limit: usage.Limit{ExpiresAt: time.Now().Add(1 * time.Hour)}},
+		},
+		cache: gcache.New(2).Simple().Build(),
+	}
+
+	_, ok := storage.Use(1)
+	assert.False(t, ok)
+
+	_, ok = storage.Use(2)
+	assert.True(t, ok)
+
+	rules := storage.GetAll()
+	assert.Len(t, rules, 1)
+	assert.Equal(t, int64(2), rules[0].ID)
+}
+
+func TestNewStorageDoesNotModifyGivenRules(t *testing.T) {
+	logger := zerolog.Nop()
+	rules := domain.Rules{
+		{ID: 1, Limit: usage.Limit{MaxMatches: 1, MatchesLeft: 1}},
+		{ID: 2, Limit: usage.Limit{MaxMatches: 2, MatchesLeft: 2}},
+	}
+	storage := NewStorage(&logger, rules, 10, time.Minute)
+
+	_, ok := storage.Use(1)
+	assert.True(t, ok)
+	_, ok = storage.Use(2)
+	assert.True(t, ok)
+
+	assert.Equal(t, domain.Rules{
+		{ID: 1, Limit: usage.Limit{MaxMatches: 1, MatchesLeft: 1}},
+		{ID: 2, Limit: usage.Limit{MaxMatches: 2, MatchesLeft: 2}},
+	}, rules)
+	assert.Len(t, storage.GetAll(), 1)
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/remoteaddr"
 	"github.com/aldas/xroad-mock-proxy/pkg/common/server"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/config"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/request"
@@ -44,7 +45,12 @@ func serve(
 
 	e.GET("/", echo.WrapHandler(defaultHandler{logger: logger}))
 
-	proxyHandler, err := createProxyHandler(logger, requestCache, serverService, ruleService)
+	trustedProxies, err := remoteaddr.Parse(serverConfig.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	proxyHandler, err := createProxyHandler(logger, requestCache, serverService, ruleService, trustedProxies)
 	if err != nil {
 		return err
 	}
@@ -78,8 +84,9 @@ func createProxyHandler(
 	requestCache request.Storage,
 	serverService proxyserver.AccessorService,
 	ruleService rule.Service,
+	trustedProxies remoteaddr.Matcher,
 ) (http.Handler, error) {
-	return NewProxyHandler(logger, serverService, ruleService, requestCache)
+	return NewProxyHandler(logger, serverService, ruleService, requestCache, trustedProxies)
 }
 
 type defaultHandler struct {
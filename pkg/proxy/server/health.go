@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// StartHealthChecks starts periodic health checks for endpoints of servers that have health check configured
+func StartHealthChecks(logger *zerolog.Logger, servers domain.ProxyServers) {
+	for _, s := range servers {
+		if s.HealthCheck.IsEmpty() || s.Endpoints == nil {
+			continue
+		}
+		for _, e := range s.Endpoints.Endpoints {
+			go runHealthChecks(logger, s, e)
+		}
+	}
+}
+
+func runHealthChecks(logger *zerolog.Logger, s domain.ProxyServer, endpoint *domain.Endpoint) {
+	check := s.HealthCheck
+	ticker := time.NewTicker(check.Interval)
+	defer ticker.Stop()
+
+	for {
+		wasHealthy := endpoint.Health.IsHealthy()
+		err := CheckHealth(s, endpoint.Address)
+		endpoint.Health.Report(err, time.Now(), check.HealthyThreshold, check.UnhealthyThreshold)
+
+		if isHealthy := endpoint.Health.IsHealthy(); isHealthy != wasHealthy {
+			logRow := logger.Warn()
+			if isHealthy {
+				logRow = logger.Info()
+			}
+			logRow.Err(err).
+				Str("server", s.Name).
+				Str("endpoint", endpoint.Address.Host).
+				Bool("healthy", isHealthy).
+				Msg("proxy server endpoint health changed")
+		}
+		<-ticker.C
+	}
+}
+
+// CheckHealth runs single health check for server endpoint with given address
+func CheckHealth(s domain.ProxyServer, address url.URL) error {
+	check := s.HealthCheck
+	switch check.Type {
+	case domain.HealthCheckTCP:
+		return checkTCP(address.Host, address.Scheme, check.Timeout)
+	case domain.HealthCheckHTTP:
+		return checkHTTP(s, address)
+	case domain.HealthCheckSOAP:
+		return checkSOAP(s, address)
+	}
+	return nil
+}
+
+func checkTCP(host string, scheme string, timeout time.Duration) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := "80"
+		if scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(host, port)
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return errors.Wrap(err, "tcp health check failed")
+	}
+	return conn.Close()
+}
+
+func checkHTTP(s domain.ProxyServer, address url.URL) error {
+	check := s.HealthCheck
+	req, err := http.NewRequest(http.MethodGet, checkURL(address, check), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create http health check request")
+	}
+	res, err := healthClient(s, check).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "http health check failed")
+	}
+	defer res.Body.Close()
+	_, _ = ioutil.ReadAll(res.Body)
+
+	if res.StatusCode != check.ExpectedStatus {
+		return errors.Errorf("http health check received status %v, expected %v", res.StatusCode, check.ExpectedStatus)
+	}
+	return nil
+}
+
+func checkSOAP(s domain.ProxyServer, address url.URL) error {
+	check := s.HealthCheck
+	body, err := soap.MetaServiceRequest(fmt.Sprintf("health-%v", rand.Uint64()), check.Client, check.Service)
+	if err != nil {
+		return errors.Wrap(err, "failed to create soap health check request")
+	}
+	req, err := http.NewRequest(http.MethodPost, checkURL(address, check), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create soap health check request")
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+
+	res, err := healthClient(s, check).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "soap health check failed")
+	}
+	defer res.Body.Close()
+	responseBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read soap health check response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("soap health check received status %v", res.StatusCode)
+	}
+	if soap.IsFault(responseBody) {
+		return errors.New("soap health check received SOAP fault")
+	}
+	return nil
+}
+
+func checkURL(address url.URL, check domain.HealthCheck) string {
+	if check.Path != "" {
+		address.Path = check.Path
+	}
+	return address.String()
+}
+
+func healthClient(s domain.ProxyServer, check domain.HealthCheck) *http.Client {
+	transport := s.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &http.Client{Transport: transport, Timeout: check.Timeout}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCheckHealthHTTP(t *testing.T) {
+	status := http.StatusOK
+	healthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer healthServer.Close()
+
+	s := testServer(t, healthServer.URL, domain.HealthCheck{Type: domain.HealthCheckHTTP, Path: "/health", ExpectedStatus: 200})
+
+	assert.NoError(t, CheckHealth(s, s.Address))
+
+	status = http.StatusServiceUnavailable
+	assert.EqualError(t, CheckHealth(s, s.Address), "http health check received status 503, expected 200")
+}
+
+func TestCheckHealthTCP(t *testing.T) {
+	healthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s := testServer(t, healthServer.URL, domain.HealthCheck{Type: domain.HealthCheckTCP})
+
+	assert.NoError(t, CheckHealth(s, s.Address))
+
+	healthServer.Close()
+	assert.Error(t, CheckHealth(s, s.Address))
+}
+
+func TestCheckHealthSOAP(t *testing.T) {
+	response := `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body><xrd:listMethodsResponse xmlns:xrd="http://x-road.eu/xsd/xroad.xsd"/></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+	var receivedHeader soap.Header
+	healthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		envelope, err := soap.FromRequestBody(body)
+		assert.NoError(t, err)
+		receivedHeader = envelope.Header
+
+		w.Write([]byte(response))
+	}))
+	defer healthServer.Close()
+
+	s := testServer(t, healthServer.URL, domain.HealthCheck{
+		Type:    domain.HealthCheckSOAP,
+		Client:  soap.ClientIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70009999", SubsystemCode: "mocksystem"},
+		Service: soap.ServiceIdentifier{XRoadInstance: "ee-test", MemberClass: "GOV", MemberCode: "70008899", SubsystemCode: "rr", ServiceCode: "listMethods"},
+	})
+
+	assert.NoError(t, CheckHealth(s, s.Address))
+	assert.Equal(t, "70009999", receivedHeader.Client.MemberCode)
+	assert.Equal(t, "listMethods", receivedHeader.Service.ServiceCode)
+
+	response = `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body><SOAP-ENV:Fault><faultcode>Server.ServerProxy</faultcode></SOAP-ENV:Fault></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+	assert.EqualError(t, CheckHealth(s, s.Address), "soap health check received SOAP fault")
+}
+
+func testServer(t *testing.T, address string, check domain.HealthCheck) domain.ProxyServer {
+	parsedURL, err := url.Parse(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check.Timeout = time.Second
+	return domain.ProxyServer{
+		Name:        "test",
+		Address:     *parsedURL,
+		HealthCheck: check,
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/compression"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// shadowRequestTimeout limits how long mirrored request can take as it is not bound to client request lifetime
+const shadowRequestTimeout = 1 * time.Minute
+
+// mirror sends copies of request asynchronously to rule shadow servers and stores their responses to shadows.
+// Body is decoded request before translation, each shadow server translates it to its own environment. Mirrored
+// requests do not affect primary request - their failures are only recorded
+func (p *proxy) mirror(
+	req *http.Request,
+	body []byte,
+	contentEncoding string,
+	shadowServers []string,
+	shadows *domain.ShadowResponses,
+) {
+	for i, name := range shadowServers {
+		shadowReq := newShadowRequest(req)
+		go func(index int, name string) {
+			shadows.Set(index, p.sendShadowRequest(shadowReq, body, contentEncoding, name))
+		}(i, name)
+	}
+}
+
+// newShadowRequest copies request without body. Copy is made synchronously as original request is changed further
+// while it is proxied
+func newShadowRequest(req *http.Request) *http.Request {
+	header := make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Del(requestIDHeader)
+	header.Del(requestRuleIDHeader)
+
+	u := *req.URL
+	return &http.Request{
+		Method:     req.Method,
+		URL:        &u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+	}
+}
+
+func (p *proxy) sendShadowRequest(
+	req *http.Request,
+	body []byte,
+	contentEncoding string,
+	serverName string,
+) domain.ShadowResponse {
+	result := domain.ShadowResponse{Server: serverName}
+
+	shadowServer, ok := p.serverService.Find(serverName)
+	if !ok {
+		result.Error = "failed to find shadow server"
+		p.logger.Error().Str("server", serverName).Msg("failed to find shadow server")
+		return result
+	}
+
+	body, err := shadowServer.Translations.Apply(body)
+	if err != nil {
+		p.logger.Warn().Err(err).Str("server", serverName).Msg("failed to translate shadow request identifiers")
+	}
+	body = encodeBody(contentEncoding, body)
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	setBody(req, body)
+
+	address := shadowServer.SelectAddress()
+	req.Host = address.Host
+	req.URL.Host = address.Host
+	req.URL.Scheme = address.Scheme
+
+	transport := shadowServer.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shadowRequestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	res, err := transport.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		result.StatusCode = res.StatusCode
+		result.Response, err = ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		// shadow response is compared to decoded primary response in client environment
+		if contentEncoding := res.Header.Get("Content-Encoding"); err == nil && compression.IsSupported(contentEncoding) {
+			result.Response, err = compression.Decode(contentEncoding, result.Response)
+		}
+		if err == nil && len(shadowServer.Translations) > 0 {
+			// response that fails to translate is compared as is
+			result.Response, _ = shadowServer.Translations.Reverse().Apply(result.Response)
+		}
+	}
+	result.ResponseTime = time.Now()
+	result.Duration = result.ResponseTime.Sub(start)
+	if err != nil {
+		result.Error = err.Error()
+		p.logger.Warn().Err(err).Str("server", serverName).Msg("failed to send request to shadow server")
+	}
+	return result
+}
+
+// shadowsFor creates pending shadow responses for rule shadow servers. Rules without shadow servers have none
+func shadowsFor(matchedRule domain.Rule) *domain.ShadowResponses {
+	if len(matchedRule.ShadowServers) == 0 {
+		return nil
+	}
+	return domain.NewShadowResponses(matchedRule.ShadowServers)
+}
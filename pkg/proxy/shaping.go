@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"github.com/aldas/xroad-mock-proxy/pkg/common/throttle"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// shapingTransport delays requests and limits speed their bodies are sent to server
+type shapingTransport struct {
+	transport http.RoundTripper
+	shaping   domain.Shaping
+}
+
+func (t shapingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.shaping.Delay(rand.Float64); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+	}
+
+	if t.shaping.RequestBytesPerSecond > 0 && req.Body != nil && req.Body != http.NoBody {
+		req = req.WithContext(req.Context())
+		req.Body = throttle.NewReader(req.Body, t.shaping.RequestBytesPerSecond)
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// shapingFor returns shaping of server with shaping of rule matched to request applied over it
+func shapingFor(hostServer domain.ProxyServer, req *http.Request) domain.Shaping {
+	shaping := hostServer.Shaping
+	if matchedRule, ok := matchedRuleFromContext(req.Context()); ok {
+		shaping = shaping.Override(matchedRule.Shaping)
+	}
+	return shaping
+}
+
+// shapeResponse limits speed response body is streamed to client
+func (p *proxy) shapeResponse(r *http.Response) {
+	hostServer, _ := p.serverService.HostToProxyServer(r.Request.URL.Host)
+	shaping := shapingFor(hostServer, r.Request)
+	if shaping.ResponseBytesPerSecond > 0 {
+		r.Body = throttle.NewReader(r.Body, shaping.ResponseBytesPerSecond)
+	}
+}
@@ -1,15 +1,25 @@
 package proxy
 
 import (
+	"fmt"
+	"github.com/aldas/xroad-mock-proxy/pkg/common/soap"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/domain"
+	"github.com/aldas/xroad-mock-proxy/pkg/proxy/request"
 	"github.com/aldas/xroad-mock-proxy/pkg/proxy/server"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type transportSwitcher struct {
 	logger        *zerolog.Logger
 	Transport     http.RoundTripper
 	serverService server.AccessorService
+	cache         request.Storage
 }
 
 // RoundTrip is to use different Transports depending on request url. This is needed in when X-road server uses TLS and
@@ -32,8 +42,172 @@ func (s transportSwitcher) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 
 	if transport == nil {
-		return http.DefaultTransport.RoundTrip(req)
+		transport = http.DefaultTransport
 	}
 
-	return transport.RoundTrip(req)
+	if res, err := s.injectFault(req); res != nil || err != nil {
+		return res, err
+	}
+	if shaping := shapingFor(hostServer, req); !shaping.IsEmpty() {
+		transport = shapingTransport{transport: transport, shaping: shaping}
+	}
+
+	// active requests are counted per endpoint for least connections load balancing
+	endpoint, hasEndpoint := hostServer.Endpoints.FindByHost(host)
+	if hasEndpoint {
+		endpoint.Acquire()
+	}
+
+	res, attempts, err := s.roundTripWithRetry(transport, hostServer, withoutInternalHeaders(req), ID)
+	s.storeAttempts(ID, attempts)
+	if res != nil {
+		// response handling needs internal headers of original request
+		res.Request = req
+	}
+
+	if hasEndpoint {
+		if res == nil {
+			endpoint.Release()
+		} else {
+			res.Body = &releaseOnCloseBody{ReadCloser: res.Body, release: endpoint.Release}
+		}
+	}
+	return res, err
+}
+
+// withoutInternalHeaders returns copy of request without headers used internally by proxy so they do not leak to
+// server
+func withoutInternalHeaders(req *http.Request) *http.Request {
+	if req.Header.Get(requestIDHeader) == "" && req.Header.Get(requestRuleIDHeader) == "" {
+		return req
+	}
+	result := req.WithContext(req.Context())
+	result.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		result.Header[k] = v
+	}
+	result.Header.Del(requestIDHeader)
+	result.Header.Del(requestRuleIDHeader)
+	return result
+}
+
+// releaseOnCloseBody releases endpoint when response body is closed
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// roundTripWithRetry sends request until it succeeds, fails with error/status that is not retryable or server retry
+// policy runs out of attempts. Request body is replayed for each attempt. Attempts are not sent while server circuit
+// breaker is open
+func (s transportSwitcher) roundTripWithRetry(
+	transport http.RoundTripper,
+	hostServer domain.ProxyServer,
+	req *http.Request,
+	ID string,
+) (*http.Response, []domain.Attempt, error) {
+	retry := hostServer.Retry
+	attempts := make([]domain.Attempt, 0, 1)
+	for i := 1; ; i++ {
+		attemptReq := req
+		if i > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempts, errors.Wrap(err, "failed to replay request body for retry")
+			}
+			attemptReq = req.WithContext(req.Context())
+			attemptReq.Body = body
+		}
+
+		start := time.Now()
+		allowed, change := hostServer.Breaker.Allow(start)
+		s.logStateChange(hostServer, change)
+		if !allowed {
+			attempts = append(attempts, domain.Attempt{StartTime: start, Error: "circuit breaker is open"})
+			faultString := fmt.Sprintf("circuit breaker for server '%v' is open", hostServer.Name)
+			return faultResponse(req, soap.FaultCodeNetworkError, faultString), attempts, nil
+		}
+
+		res, err := transport.RoundTrip(attemptReq)
+		attempt := domain.Attempt{StartTime: start, Duration: time.Since(start)}
+
+		isRetryable := false
+		if err != nil {
+			attempt.Error = err.Error()
+			isRetryable = retry.IsRetryableError(err)
+			if req.Context().Err() != nil {
+				// request cancelled by client does not say anything about server state
+				hostServer.Breaker.Release()
+			} else {
+				s.logStateChange(hostServer, hostServer.Breaker.Report(false, time.Now()))
+			}
+		} else {
+			attempt.StatusCode = res.StatusCode
+			isRetryable = retry.IsRetryableStatus(res.StatusCode)
+			isFailure := hostServer.Breaker.IsFailureStatus(res.StatusCode)
+			s.logStateChange(hostServer, hostServer.Breaker.Report(!isFailure, time.Now()))
+		}
+		attempts = append(attempts, attempt)
+
+		if !isRetryable || i >= retry.Attempts() || !canReplayBody(req) {
+			return res, attempts, err
+		}
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+
+		backoff := retry.BackoffFor(i)
+		s.logger.Warn().
+			Str("ID", ID).
+			Str("url.host", req.URL.Host).
+			Int("attempt", i).
+			Int("status", attempt.StatusCode).
+			Str("error", attempt.Error).
+			Dur("backoff", backoff).
+			Msg("retrying proxied request")
+
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, attempts, req.Context().Err()
+		}
+	}
+}
+
+func (s transportSwitcher) logStateChange(hostServer domain.ProxyServer, change domain.StateChange) {
+	if !change.IsChanged() {
+		return
+	}
+	logRow := s.logger.Warn()
+	if change.To == domain.CircuitClosed {
+		logRow = s.logger.Info()
+	}
+	logRow.Str("server", hostServer.Name).
+		Str("from", string(change.From)).
+		Str("to", string(change.To)).
+		Msg("circuit breaker state changed")
+}
+
+func canReplayBody(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (s transportSwitcher) storeAttempts(ID string, attempts []domain.Attempt) {
+	if ID == "" || s.cache == nil {
+		return
+	}
+	cached, ok := s.cache.Get(ID)
+	if !ok {
+		return
+	}
+	cached.Attempts = attempts
+	s.cache.Set(cached)
 }